@@ -0,0 +1,223 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/holavonat/holavonatis/internal/logger"
+)
+
+const AlertsTemplate = "alerts"
+
+// AlertFilter are the arguments of the alerts query, empty ones match all.
+type AlertFilter struct {
+	Feeds         []string
+	SeverityLevel []string
+	Effect        []string
+	Cause         []string
+	Route         []string
+	Stop          []string
+}
+
+func (f AlertFilter) Variables() map[string]any {
+	variables := make(map[string]any)
+	for name, values := range map[string][]string{
+		"feeds":         f.Feeds,
+		"severityLevel": f.SeverityLevel,
+		"effect":        f.Effect,
+		"cause":         f.Cause,
+		"route":         f.Route,
+		"stop":          f.Stop,
+	} {
+		if len(values) > 0 {
+			variables[name] = values
+		}
+	}
+	return variables
+}
+
+type AlertRoute struct {
+	GtfsID    string `json:"gtfsId"`
+	Mode      string `json:"mode,omitempty"`
+	ShortName string `json:"shortName,omitempty"`
+}
+
+type AlertStop struct {
+	GtfsID string `json:"gtfsId"`
+	Name   string `json:"name,omitempty"`
+}
+
+type AlertTrip struct {
+	GtfsID        string `json:"gtfsId"`
+	TripShortName string `json:"tripShortName,omitempty"`
+}
+
+// Alert is a service alert with the entities of every upstream alert that
+// shares its alertHash.
+type Alert struct {
+	Alerts
+	Routes    []AlertRoute `json:"routes,omitempty"`
+	Stops     []AlertStop  `json:"stops,omitempty"`
+	Trips     []AlertTrip  `json:"trips,omitempty"`
+	FirstSeen int64        `json:"firstSeen"`
+	LastSeen  int64        `json:"lastSeen"`
+	Active    bool         `json:"active"`
+}
+
+type AlertsFeed struct {
+	Source      Source        `json:"source"`
+	Timestamp   string        `json:"timestamp"`
+	Alerts      []Alert       `json:"alerts"`
+	LastUpdated int64         `json:"lastUpdated"`
+	Errors      GraphQLErrors `json:"errors,omitempty"`
+}
+
+type upstreamAlert struct {
+	Alerts
+	Route *AlertRoute `json:"route"`
+	Stop  *AlertStop  `json:"stop"`
+	Trip  *AlertTrip  `json:"trip"`
+}
+
+type alertsResponse struct {
+	Data struct {
+		Alerts []upstreamAlert `json:"alerts"`
+	} `json:"data"`
+	Errors GraphQLErrors `json:"errors,omitempty"`
+}
+
+// Alerts runs an alerts query template and merges the alerts by alertHash.
+func (c *Client) Alerts(ctx context.Context, query string, variables map[string]any) ([]Alert, GraphQLErrors, error) {
+	var result alertsResponse
+	errs, err := c.decode(ctx, query, variables, &result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(errs) > 0 {
+		log.New("api").Warnw("Upstream returned partial alerts", "errors", errs.Error(), "alerts", len(result.Data.Alerts))
+	}
+
+	return mergeAlerts(result.Data.Alerts), errs, nil
+}
+
+func mergeAlerts(upstream []upstreamAlert) []Alert {
+	var alerts []Alert
+	index := make(map[string]int)
+	for _, u := range upstream {
+		key := alertKey(u.Alerts)
+		i, ok := index[key]
+		if !ok {
+			i = len(alerts)
+			index[key] = i
+			alerts = append(alerts, Alert{Alerts: u.Alerts})
+		}
+
+		alert := &alerts[i]
+		if u.Route != nil && !slices.Contains(alert.Routes, *u.Route) {
+			alert.Routes = append(alert.Routes, *u.Route)
+		}
+		if u.Stop != nil && !slices.Contains(alert.Stops, *u.Stop) {
+			alert.Stops = append(alert.Stops, *u.Stop)
+		}
+		if u.Trip != nil && !slices.Contains(alert.Trips, *u.Trip) {
+			alert.Trips = append(alert.Trips, *u.Trip)
+		}
+	}
+	return alerts
+}
+
+// alertKey is the alertHash, or the id for alerts without one.
+func alertKey(alert Alerts) string {
+	if alert.AlertHash != 0 {
+		return strconv.Itoa(alert.AlertHash)
+	}
+	return "id:" + alert.ID
+}
+
+// AlertTracker remembers when each alert was first and last seen. Alerts
+// that disappear stay in the output as inactive until they are unseen for
+// longer than Retention, so one that returns briefly keeps its FirstSeen.
+type AlertTracker struct {
+	Retention time.Duration
+	seen      map[string]Alert
+}
+
+func NewAlertTracker(retention time.Duration) *AlertTracker {
+	return &AlertTracker{
+		Retention: retention,
+		seen:      make(map[string]Alert),
+	}
+}
+
+// Seed restores the tracked alerts, e.g. from the previous output.
+func (t *AlertTracker) Seed(alerts []Alert) {
+	for _, alert := range alerts {
+		if alert.FirstSeen > 0 {
+			t.seen[alertKey(alert.Alerts)] = alert
+		}
+	}
+}
+
+// Track sets FirstSeen and LastSeen of the current alerts and appends the
+// ended ones still within Retention as inactive, most recently seen first.
+func (t *AlertTracker) Track(alerts []Alert, now time.Time) []Alert {
+	unix := now.Unix()
+	current := make(map[string]bool, len(alerts))
+	for i := range alerts {
+		key := alertKey(alerts[i].Alerts)
+		alerts[i].FirstSeen = unix
+		if seen, ok := t.seen[key]; ok {
+			alerts[i].FirstSeen = seen.FirstSeen
+		}
+		alerts[i].LastSeen = unix
+		alerts[i].Active = true
+		t.seen[key] = alerts[i]
+		current[key] = true
+	}
+
+	var ended []Alert
+	for key, alert := range t.seen {
+		if current[key] {
+			continue
+		}
+		if t.Retention > 0 && now.Sub(time.Unix(alert.LastSeen, 0)) > t.Retention {
+			delete(t.seen, key)
+			continue
+		}
+		alert.Active = false
+		ended = append(ended, alert)
+	}
+	slices.SortFunc(ended, func(a, b Alert) int {
+		return cmp.Or(cmp.Compare(b.LastSeen, a.LastSeen), strings.Compare(a.ID, b.ID))
+	})
+
+	return append(alerts, ended...)
+}
+
+// FetchAlerts fetches the network-wide service alerts, query is the alerts
+// template, the bundled one when empty.
+func (e *Upstream) FetchAlerts(ctx context.Context, query string, filter AlertFilter) (AlertsFeed, error) {
+	if query == "" {
+		query = DefaultTemplates()[AlertsTemplate]
+	}
+
+	alerts, errs, err := e.Client.Alerts(ctx, query, filter.Variables())
+	if err != nil {
+		return AlertsFeed{}, err
+	}
+	if alerts == nil {
+		alerts = []Alert{}
+	}
+
+	return AlertsFeed{
+		Alerts:      alerts,
+		LastUpdated: time.Now().Unix(),
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Errors:      errs,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestFetchAlerts(t *testing.T) {
+	var variables map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request struct {
+			Variables map[string]any `json:"variables"`
+		}
+		r.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		variables = request.Variables
+		w.Write([]byte(`{"data":{"alerts":[
+			{"id":"a1","alertHash":42,"alertHeaderText":"Track works","route":{"gtfsId":"1:10"}},
+			{"id":"a2","alertHash":42,"alertHeaderText":"Track works","route":{"gtfsId":"1:20"},"stop":{"gtfsId":"1:s1"}},
+			{"id":"a3","alertHash":7,"alertHeaderText":"Strike"}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+
+	upstream := &api.Upstream{Client: client}
+	feed, err := upstream.FetchAlerts(context.Background(), "", api.AlertFilter{SeverityLevel: []string{"SEVERE"}})
+	r.NoError(t, err)
+	r.Equal(t, map[string]any{"severityLevel": []any{"SEVERE"}}, variables)
+
+	r.Len(t, feed.Alerts, 2)
+	r.Equal(t, "a1", feed.Alerts[0].ID)
+	r.Equal(t, []api.AlertRoute{{GtfsID: "1:10"}, {GtfsID: "1:20"}}, feed.Alerts[0].Routes)
+	r.Equal(t, []api.AlertStop{{GtfsID: "1:s1"}}, feed.Alerts[0].Stops)
+
+	tracker := api.NewAlertTracker(time.Hour)
+	start := time.Unix(1000, 0)
+	alerts := tracker.Track(feed.Alerts, start)
+	r.Equal(t, int64(1000), alerts[0].FirstSeen)
+	r.Equal(t, int64(1000), alerts[0].LastSeen)
+
+	r.True(t, alerts[0].Active)
+
+	// The strike ended, it stays in the output as inactive.
+	alerts = tracker.Track(feed.Alerts[:1], start.Add(time.Minute))
+	r.Len(t, alerts, 2)
+	r.Equal(t, int64(1000), alerts[0].FirstSeen)
+	r.Equal(t, int64(1060), alerts[0].LastSeen)
+	r.True(t, alerts[0].Active)
+	r.Equal(t, "a3", alerts[1].ID)
+	r.Equal(t, int64(1000), alerts[1].LastSeen)
+	r.False(t, alerts[1].Active)
+
+	// The strike was gone for longer than the retention, it is a new alert.
+	r.Empty(t, tracker.Track(nil, start.Add(2*time.Hour)))
+	alerts = tracker.Track(feed.Alerts[1:], start.Add(2*time.Hour))
+	r.Len(t, alerts, 1)
+	r.Equal(t, int64(1000+7200), alerts[0].FirstSeen)
+
+	restored := api.NewAlertTracker(time.Hour)
+	restored.Seed([]api.Alert{
+		{Alerts: api.Alerts{AlertHash: 42}, FirstSeen: 500, LastSeen: 900},
+		{Alerts: api.Alerts{ID: "old", AlertHash: 9}, FirstSeen: 100, LastSeen: 900},
+	})
+	alerts = restored.Track(feed.Alerts[:1], start)
+	r.Len(t, alerts, 2)
+	r.Equal(t, int64(500), alerts[0].FirstSeen)
+	r.Equal(t, "old", alerts[1].ID)
+	r.False(t, alerts[1].Active)
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/holavonat/holavonatis/internal/logger"
+)
+
+const CancellationsTemplate = "cancelledTripTimes"
+
+// CancellationFilter selects the cancelled trips departing between From and
+// To, the feeds and routes are optional.
+type CancellationFilter struct {
+	From     time.Time
+	To       time.Time
+	Feeds    []string
+	Routes   []string
+	Language string
+}
+
+// Variables expresses the window per service date, as the date and seconds
+// since the start of that service day. The service date of From runs to To,
+// past 86400 like the departure times of trips running overnight. When To
+// falls on the next service date, that date is queried as well from its
+// start to To.
+func (f CancellationFilter) Variables() []map[string]any {
+	from := ServiceDayStart(f.From)
+	to := ServiceDayStart(f.To)
+
+	list := []map[string]any{f.variables(from, int(f.From.Sub(from).Seconds()))}
+	if to.After(from) {
+		list = append(list, f.variables(to, 0))
+	}
+	return list
+}
+
+func (f CancellationFilter) variables(day time.Time, minDepartureTime int) map[string]any {
+	date := day.In(Location).Format("20060102")
+	variables := map[string]any{
+		"minDate":          date,
+		"maxDate":          date,
+		"minDepartureTime": minDepartureTime,
+		"maxDepartureTime": int(f.To.Sub(day).Seconds()),
+		"language":         f.Language,
+	}
+	if f.Language == "" {
+		variables["language"] = DefaultLanguage
+	}
+	if len(f.Feeds) > 0 {
+		variables["feeds"] = f.Feeds
+	}
+	if len(f.Routes) > 0 {
+		variables["routes"] = f.Routes
+	}
+	return variables
+}
+
+type CancelledStop struct {
+	Stop               Stop  `json:"stop"`
+	StopPosition       int   `json:"stopPosition"`
+	ScheduledArrival   int64 `json:"scheduledArrival"`
+	ScheduledDeparture int64 `json:"scheduledDeparture"`
+}
+
+// Cancellation is a cancelled trip on a service day with its cancelled stops.
+type Cancellation struct {
+	Route              Route           `json:"route"`
+	TripID             string          `json:"tripId"`
+	TripNumber         string          `json:"tripNumber,omitempty"`
+	TripShortName      string          `json:"tripShortName,omitempty"`
+	RouteShortName     string          `json:"routeShortName,omitempty"`
+	Headsign           string          `json:"headsign,omitempty"`
+	Stops              []CancelledStop `json:"stops"`
+	ServiceDay         int64           `json:"serviceDay"`
+	ScheduledDeparture int64           `json:"scheduledDeparture"`
+	ScheduledArrival   int64           `json:"scheduledArrival"`
+}
+
+type CancellationsFeed struct {
+	Source        Source         `json:"source"`
+	Timestamp     string         `json:"timestamp"`
+	Cancellations []Cancellation `json:"cancellations"`
+	LastUpdated   int64          `json:"lastUpdated"`
+	Errors        GraphQLErrors  `json:"errors,omitempty"`
+}
+
+type cancelledStoptime struct {
+	Stop               Stop   `json:"stop"`
+	Headsign           string `json:"headsign"`
+	ServiceDay         int64  `json:"serviceDay"`
+	StopPosition       int    `json:"stopPosition"`
+	ScheduledArrival   int64  `json:"scheduledArrival"`
+	ScheduledDeparture int64  `json:"scheduledDeparture"`
+	Trip               struct {
+		Route          Route  `json:"route"`
+		GtfsID         string `json:"gtfsId"`
+		TripShortName  string `json:"tripShortName"`
+		TripHeadsign   string `json:"tripHeadsign"`
+		TripNumber     string `json:"tripNumber"`
+		RouteShortName string `json:"routeShortName"`
+	} `json:"trip"`
+}
+
+type cancellationsResponse struct {
+	Data struct {
+		CancelledTripTimes []cancelledStoptime `json:"cancelledTripTimes"`
+	} `json:"data"`
+}
+
+// CancelledTrips runs a cancelledTripTimes query template and groups the
+// stoptimes by trip and service day.
+func (c *Client) CancelledTrips(ctx context.Context, query string, variables map[string]any) ([]Cancellation, GraphQLErrors, error) {
+	var result cancellationsResponse
+	errs, err := c.decode(ctx, query, variables, &result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(errs) > 0 {
+		log.New("api").Warnw("Upstream returned partial cancellations", "errors", errs.Error(), "stoptimes", len(result.Data.CancelledTripTimes))
+	}
+
+	return groupCancellations(result.Data.CancelledTripTimes), errs, nil
+}
+
+type tripDay struct {
+	trip       string
+	serviceDay int64
+}
+
+func groupCancellations(stoptimes []cancelledStoptime) []Cancellation {
+	cancellations := []Cancellation{}
+	index := make(map[tripDay]int)
+	for _, st := range stoptimes {
+		key := tripDay{st.Trip.GtfsID, st.ServiceDay}
+		i, ok := index[key]
+		if !ok {
+			i = len(cancellations)
+			index[key] = i
+			headsign := st.Trip.TripHeadsign
+			if headsign == "" {
+				headsign = st.Headsign
+			}
+			cancellations = append(cancellations, Cancellation{
+				Route:          st.Trip.Route,
+				TripID:         st.Trip.GtfsID,
+				TripNumber:     st.Trip.TripNumber,
+				TripShortName:  st.Trip.TripShortName,
+				RouteShortName: st.Trip.RouteShortName,
+				Headsign:       headsign,
+				ServiceDay:     st.ServiceDay,
+			})
+		}
+
+		cancellations[i].Stops = append(cancellations[i].Stops, CancelledStop{
+			Stop:               st.Stop,
+			StopPosition:       st.StopPosition,
+			ScheduledArrival:   st.ScheduledArrival,
+			ScheduledDeparture: st.ScheduledDeparture,
+		})
+	}
+
+	for i := range cancellations {
+		stops := cancellations[i].Stops
+		slices.SortFunc(stops, func(a, b CancelledStop) int {
+			return a.StopPosition - b.StopPosition
+		})
+		cancellations[i].ScheduledDeparture = stops[0].ScheduledDeparture
+		cancellations[i].ScheduledArrival = stops[len(stops)-1].ScheduledArrival
+	}
+
+	return cancellations
+}
+
+// FetchCancellations fetches the cancelled trips with one query per service
+// date of the window, query is the cancelledTripTimes template, the bundled
+// one when empty.
+func (e *Upstream) FetchCancellations(ctx context.Context, query string, filter CancellationFilter) (CancellationsFeed, error) {
+	if query == "" {
+		query = DefaultTemplates()[CancellationsTemplate]
+	}
+
+	cancellations := []Cancellation{}
+	var errs GraphQLErrors
+	seen := make(map[tripDay]bool)
+	for _, variables := range filter.Variables() {
+		list, partial, err := e.Client.CancelledTrips(ctx, query, variables)
+		if err != nil {
+			return CancellationsFeed{}, err
+		}
+		errs = append(errs, partial...)
+		for _, cancellation := range list {
+			key := tripDay{cancellation.TripID, cancellation.ServiceDay}
+			if !seen[key] {
+				seen[key] = true
+				cancellations = append(cancellations, cancellation)
+			}
+		}
+	}
+
+	return CancellationsFeed{
+		Cancellations: cancellations,
+		LastUpdated:   time.Now().Unix(),
+		Timestamp:     time.Now().Format(time.RFC3339),
+		Errors:        errs,
+	}, nil
+}
+
+// Cancellations holds the last fetched cancellations so the vehicle snapshot
+// can mark the trips that show up anyway (partially cancelled trips).
+type Cancellations struct {
+	mu    sync.RWMutex
+	trips map[tripDay][]string
+}
+
+func (c *Cancellations) Set(cancellations []Cancellation) {
+	trips := make(map[tripDay][]string, len(cancellations))
+	for _, cancellation := range cancellations {
+		stops := make([]string, 0, len(cancellation.Stops))
+		for _, stop := range cancellation.Stops {
+			stops = append(stops, stop.Stop.GtfsID)
+		}
+		trips[tripDay{cancellation.TripID, cancellation.ServiceDay}] = stops
+	}
+
+	c.mu.Lock()
+	c.trips = trips
+	c.mu.Unlock()
+}
+
+// Mark flags the vehicles running a cancelled trip and lists the cancelled
+// stops of their trip.
+func (c *Cancellations) Mark(data *Holavonat) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	marked := 0
+	for i := range data.VehiclePositions {
+		trip := &data.VehiclePositions[i].Trip
+		if trip.GtfsID == "" {
+			continue
+		}
+
+		serviceDay := ServiceDayStart(time.Now()).Unix()
+		if len(trip.Stoptimes) > 0 && trip.Stoptimes[0].ServiceDay != 0 {
+			serviceDay = trip.Stoptimes[0].ServiceDay
+		}
+		stops, ok := c.trips[tripDay{trip.GtfsID, serviceDay}]
+		if !ok {
+			continue
+		}
+
+		trip.Cancelled = true
+		trip.CancelledStops = stops
+		marked++
+	}
+	return marked
+}
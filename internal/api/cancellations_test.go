@@ -0,0 +1,89 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestFetchCancellations(t *testing.T) {
+	var variables []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request struct {
+			Variables map[string]any `json:"variables"`
+		}
+		r.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		variables = append(variables, request.Variables)
+		if request.Variables["minDate"] == "20250702" {
+			w.Write([]byte(`{"data":{"cancelledTripTimes":[
+				{"serviceDay":1751407200,"stopPosition":1,"scheduledArrival":1800,"scheduledDeparture":1800,"stop":{"gtfsId":"1:d"},"trip":{"gtfsId":"1:t3"}}
+			]}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"cancelledTripTimes":[
+			{"serviceDay":1751320800,"stopPosition":2,"scheduledArrival":30000,"scheduledDeparture":30060,"stop":{"gtfsId":"1:b"},"trip":{"gtfsId":"1:t1","tripNumber":"2612","tripHeadsign":"Szeged","route":{"mode":"RAIL","shortName":"IC"}}},
+			{"serviceDay":1751320800,"stopPosition":1,"scheduledArrival":28000,"scheduledDeparture":28000,"stop":{"gtfsId":"1:a"},"trip":{"gtfsId":"1:t1","tripNumber":"2612","tripHeadsign":"Szeged","route":{"mode":"RAIL","shortName":"IC"}}},
+			{"serviceDay":1751320800,"stopPosition":5,"scheduledArrival":40000,"scheduledDeparture":40000,"stop":{"gtfsId":"1:c"},"trip":{"gtfsId":"1:t2","tripNumber":"4500"}}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+
+	// 2025-07-01 23:00 to 2025-07-02 01:00 in Budapest, both service dates
+	// are queried.
+	from := time.Date(2025, 7, 1, 23, 0, 0, 0, api.Location)
+	upstream := &api.Upstream{Client: client}
+	feed, err := upstream.FetchCancellations(context.Background(), "", api.CancellationFilter{From: from, To: from.Add(2 * time.Hour)})
+	r.NoError(t, err)
+	r.Len(t, variables, 2)
+	r.Equal(t, "20250701", variables[0]["minDate"])
+	r.Equal(t, "20250701", variables[0]["maxDate"])
+	r.Equal(t, float64(23*3600), variables[0]["minDepartureTime"])
+	r.Equal(t, float64(25*3600), variables[0]["maxDepartureTime"])
+	r.Equal(t, "20250702", variables[1]["minDate"])
+	r.Equal(t, "20250702", variables[1]["maxDate"])
+	r.Equal(t, float64(0), variables[1]["minDepartureTime"])
+	r.Equal(t, float64(3600), variables[1]["maxDepartureTime"])
+
+	r.Len(t, feed.Cancellations, 3)
+	r.Equal(t, "1:t3", feed.Cancellations[2].TripID)
+	r.Equal(t, int64(1751407200), feed.Cancellations[2].ServiceDay)
+
+	first := feed.Cancellations[0]
+	r.Equal(t, "1:t1", first.TripID)
+	r.Equal(t, "Szeged", first.Headsign)
+	r.Equal(t, "RAIL", first.Route.Mode)
+	r.Equal(t, int64(28000), first.ScheduledDeparture)
+	r.Equal(t, int64(30000), first.ScheduledArrival)
+	r.Equal(t, "1:a", first.Stops[0].Stop.GtfsID)
+
+	var cancellations api.Cancellations
+	cancellations.Set(feed.Cancellations)
+	data := api.Holavonat{VehiclePositions: []api.VehiclePositions{
+		{VehicleID: "v1", Trip: api.Trip{GtfsID: "1:t1", Stoptimes: []api.Stoptimes{{ServiceDay: 1751320800}}}},
+		{VehicleID: "v2", Trip: api.Trip{GtfsID: "1:t1", Stoptimes: []api.Stoptimes{{ServiceDay: 1751407200}}}},
+		{VehicleID: "v3", Trip: api.Trip{GtfsID: "1:t3"}},
+	}}
+	r.Equal(t, 1, cancellations.Mark(&data))
+	r.True(t, data.VehiclePositions[0].Trip.Cancelled)
+	r.Equal(t, []string{"1:a", "1:b"}, data.VehiclePositions[0].Trip.CancelledStops)
+	r.False(t, data.VehiclePositions[1].Trip.Cancelled)
+}
+
+func TestCancellationFilterVariables(t *testing.T) {
+	from := time.Date(2025, 7, 1, 8, 0, 0, 0, api.Location)
+	variables := api.CancellationFilter{From: from, To: from.Add(2 * time.Hour), Feeds: []string{"1"}}.Variables()
+	r.Len(t, variables, 1)
+	r.Equal(t, "20250701", variables[0]["maxDate"])
+	r.Equal(t, 8*3600, variables[0]["minDepartureTime"])
+	r.Equal(t, 10*3600, variables[0]["maxDepartureTime"])
+	r.Equal(t, []string{"1"}, variables[0]["feeds"])
+}
@@ -2,13 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"time"
 
+	log "github.com/holavonat/holavonatis/internal/logger"
 	_ "golang.org/x/crypto/x509roots/fallback"
 )
 
@@ -20,6 +23,22 @@ type Client struct {
 	Client   *http.Client
 	Headers  map[string]string
 	Endpoint string
+	Retry    RetryPolicy
+	// AllowPartial accepts responses with both data and GraphQL errors.
+	AllowPartial bool
+	Observer     Observer
+}
+
+// Observer records the upstream requests, code is 0 when no response was
+// received.
+type Observer interface {
+	ObserveFetch(code int, duration time.Duration)
+}
+
+func (c *Client) observe(code int, start time.Time) {
+	if c.Observer != nil {
+		c.Observer.ObserveFetch(code, time.Since(start))
+	}
 }
 
 func NewClient(endpoint string, headers map[string]string) *Client {
@@ -76,13 +95,76 @@ func NewClientCustomHTTP(endpoint string, headers map[string]string, client *htt
 	}, nil
 }
 
-func (c *Client) Do(query string) ([]byte, error) {
-	reqBody, err := json.Marshal(map[string]string{"query": query})
+// Do posts the query without variables, see Query.
+func (c *Client) Do(ctx context.Context, query string) ([]byte, error) {
+	return c.Query(ctx, query, nil)
+}
+
+// Query posts the query with its variables and returns the response body.
+// GraphQL errors are returned as GraphQLErrors; when the response also
+// carries partial data the body is returned next to the error.
+func (c *Client) Query(ctx context.Context, query string, variables map[string]any) ([]byte, error) {
+	reqBody, err := json.Marshal(struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables,omitempty"`
+	}{query, variables})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal query: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewBuffer(reqBody))
+	l := log.New("api")
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		body, err := c.attempt(ctx, reqBody, attempt, start)
+		if err == nil {
+			errs, data := checkErrors(body)
+			if len(errs) == 0 || data {
+				if attempt > 1 {
+					l.Infow("Request succeeded after retry", "attempt", attempt)
+				}
+				if len(errs) > 0 {
+					return body, errs
+				}
+				return body, nil
+			}
+			err = errs
+		}
+
+		if attempt >= c.Retry.MaxAttempts || !c.Retry.retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := c.Retry.wait(attempt, err)
+		if c.Retry.Deadline > 0 && time.Since(start)+wait >= c.Retry.Deadline {
+			l.Warnw("Retry deadline exceeded, giving up", "attempt", attempt, "wait", wait.String(), "deadline", c.Retry.Deadline.String(), "error", err)
+			return nil, err
+		}
+
+		l.Warnw("Request failed, retrying", "attempt", attempt, "max_attempts", c.Retry.MaxAttempts, "wait", wait.String(), "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once. The first attempt is only limited by the
+// client timeout, the retries also by the total deadline counted from start,
+// which cancels a retry in flight instead of letting it overrun.
+func (c *Client) attempt(ctx context.Context, reqBody []byte, attempt int, start time.Time) ([]byte, error) {
+	if attempt > 1 && c.Retry.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(c.Retry.Deadline))
+		defer cancel()
+	}
+	return c.do(ctx, reqBody)
+}
+
+func (c *Client) do(ctx context.Context, reqBody []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, err
 	}
@@ -90,129 +172,81 @@ func (c *Client) Do(query string) ([]byte, error) {
 		req.Header.Set(k, v)
 	}
 
+	start := time.Now()
 	resp, err := c.Client.Do(req)
 	if err != nil {
+		c.observe(0, start)
 		return nil, err
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status: %s", resp.Status)
+		io.Copy(io.Discard, resp.Body)
+		c.observe(resp.StatusCode, start)
+		return nil, newStatusError(resp)
 	}
 
-	return io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.observe(0, start)
+		return nil, err
+	}
+	c.observe(resp.StatusCode, start)
+	return body, nil
 }
 
-func (c *Client) AllDetails(serviceDay string) (OTPResponse, error) {
+func (c *Client) AllDetails(ctx context.Context, serviceDay string) (OTPResponse, error) {
+	if err := validateServiceDay(serviceDay); err != nil {
+		return OTPResponse{}, err
+	}
+
+	return c.VehiclePositions(ctx, DefaultTemplates()[DefaultTemplate], DefaultParams().Variables(serviceDay))
+}
+
+func validateServiceDay(serviceDay string) error {
 	if serviceDay == "" {
-		return OTPResponse{}, fmt.Errorf("serviceDay cannot be empty")
+		return fmt.Errorf("serviceDay cannot be empty")
 	}
 
 	if _, err := time.Parse("20060102", serviceDay); err != nil {
-		return OTPResponse{}, fmt.Errorf("invalid serviceDay format: %w", err)
-	}
-
-	query := fmt.Sprintf(`
-		 {
-        vehiclePositions(
-            swLat: 45.5,
-			swLon: 16.1,
-			neLat: 48.7,
-			neLon: 22.8,
-            modes: [TRAM,RAIL,RAIL_REPLACEMENT_BUS,SUBURBAN_RAILWAY,TRAMTRAIN],
-        ) {
-            vehicleId
-            lat
-            lon
-			label
-            heading
-            lastUpdated
-            speed
-            stopRelationship {
-                status
-                stop {
-                    gtfsId
-                    name
-                }
-            }
-            trip {
-                id
-                stoptimes: stoptimesForDate(
-                  serviceDate: "%s"
-                ){
-                  stop {
-    								name
-    								lat
-    								lon
-    								platformCode
-    							}
-    							realtimeArrival
-    							realtimeDeparture
-    							arrivalDelay
-    							departureDelay
-    							scheduledArrival
-    							scheduledDeparture        
-                }
-                gtfsId
-                routeShortName
-                tripHeadsign
-                tripShortName
-                trainName
-        				domesticResTrainNumber
-        				wheelchairAccessible
-        				bikesAllowed
-                trainCategoryBaseId
-                tripNumber
-                tripGeometry {
-                  length
-                  points
-                }
-                alerts {
-                  id
-                  alertHash
-                  feed
-                  alertHeaderText
-                  alertDescriptionText
-                  alertCause
-                  alertSeverityLevel
-                  alertUrl
-                  alertEffect
-                  effectiveEndDate
-                  effectiveStartDate
-                                
-                }
-                trainCategoryId
-        				infoServices {
-        					name
-        					fromStopIndex
-        					tillStopIndex
-        					fontCharSet
-        					fontCode
-        					displayable
-        				}
-                route {
-                    mode
-                    shortName
-                    longName(language: "hu")
-                    textColor
-                    color
-                }
-                pattern {
-                    id
-                }
-            }
-        }
-    }`, serviceDay)
-	body, err := c.Do(query)
-	if err != nil {
-		return OTPResponse{}, err
+		return fmt.Errorf("invalid serviceDay format: %w", err)
 	}
 
+	return nil
+}
+
+// VehiclePositions runs a vehiclePositions query template with the variables.
+func (c *Client) VehiclePositions(ctx context.Context, query string, variables map[string]any) (OTPResponse, error) {
 	var result OTPResponse
-	if err := json.Unmarshal(body, &result); err != nil {
+	errs, err := c.decode(ctx, query, variables, &result)
+	if err != nil {
 		return OTPResponse{}, err
 	}
 
+	if len(errs) > 0 {
+		log.New("api").Warnw("Upstream returned partial data", "errors", errs.Error(), "vehicles", len(result.Data.VehiclePositions))
+	}
+
 	return result, nil
 }
+
+// decode runs the query and unmarshals the response body into result. Partial
+// data is only accepted with AllowPartial, its errors are returned then.
+func (c *Client) decode(ctx context.Context, query string, variables map[string]any, result any) (GraphQLErrors, error) {
+	body, err := c.Query(ctx, query, variables)
+	var errs GraphQLErrors
+	if err != nil && !(errors.As(err, &errs) && body != nil) {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 && !c.AllowPartial {
+		return nil, errs
+	}
+
+	return errs, nil
+}
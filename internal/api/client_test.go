@@ -0,0 +1,201 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestDoRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"data":{}}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+	client.Retry = api.RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	}
+
+	body, err := client.Do(context.Background(), "{ feeds { feedId } }")
+	r.NoError(t, err)
+	r.JSONEq(t, `{"data":{}}`, string(body))
+	r.Equal(t, int32(3), calls.Load())
+}
+
+func TestDoRetryGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+	client.Retry = api.RetryPolicy{
+		MaxAttempts: 5,
+		Deadline:    time.Second,
+	}
+
+	_, err = client.Do(context.Background(), "{ feeds { feedId } }")
+	var statusErr *api.StatusError
+	r.ErrorAs(t, err, &statusErr)
+	r.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	r.Equal(t, 2*time.Minute, statusErr.RetryAfter)
+	r.Equal(t, int32(1), calls.Load())
+
+	client.Retry = api.RetryPolicy{MaxAttempts: 5, Statuses: []int{http.StatusBadGateway}}
+	_, err = client.Do(context.Background(), "{ feeds { feedId } }")
+	r.Error(t, err)
+	r.Equal(t, int32(2), calls.Load())
+}
+
+func TestDoRetryDeadline(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+	client.Retry = api.RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		Deadline:    100 * time.Millisecond,
+	}
+
+	// The retry in flight is cancelled at the deadline.
+	start := time.Now()
+	_, err = client.Do(context.Background(), "{ feeds { feedId } }")
+	r.ErrorIs(t, err, context.DeadlineExceeded)
+	r.Less(t, time.Since(start), time.Second)
+	r.Equal(t, int32(2), calls.Load())
+}
+
+func TestDoFirstAttemptOutlivesDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte(`{"data":{"feeds":[]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+	client.Retry = api.RetryPolicy{
+		MaxAttempts: 3,
+		Deadline:    50 * time.Millisecond,
+	}
+
+	_, err = client.Do(context.Background(), "{ feeds { feedId } }")
+	r.NoError(t, err)
+}
+
+func TestBackoff(t *testing.T) {
+	policy := api.RetryPolicy{BaseBackoff: time.Second}
+	for _, retry := range []int{1, 10, 64, 100, 1000} {
+		wait := policy.Backoff(retry)
+		r.GreaterOrEqual(t, wait, time.Duration(0))
+		r.LessOrEqual(t, wait, api.DefaultMaxBackoff)
+	}
+	r.LessOrEqual(t, policy.Backoff(1), time.Second)
+
+	policy.MaxBackoff = 5 * time.Second
+	r.LessOrEqual(t, policy.Backoff(100), 5*time.Second)
+}
+
+func TestAllDetailsGraphQLErrors(t *testing.T) {
+	response := `{"errors":[{"message":"Timeout","locations":[{"line":3,"column":9}],"path":["vehiclePositions",0,"trip"],"extensions":{"classification":"ExecutionAborted"}}],"data":null}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+	client.AllowPartial = true
+
+	_, err = client.AllDetails(context.Background(), "20250701")
+	var errs api.GraphQLErrors
+	r.ErrorAs(t, err, &errs)
+	r.Len(t, errs, 1)
+	r.Equal(t, "ExecutionAborted", errs[0].Extensions["classification"])
+	r.Equal(t, "graphql: Timeout (path: vehiclePositions.0.trip)", errs[0].Error())
+
+	response = `{"errors":[{"message":"Timeout","path":["vehiclePositions",1,"trip"]}],"data":{"vehiclePositions":[{"vehicleId":"1"}]}}`
+	details, err := client.AllDetails(context.Background(), "20250701")
+	r.NoError(t, err)
+	r.Len(t, details.Data.VehiclePositions, 1)
+	r.Len(t, details.Errors, 1)
+
+	client.AllowPartial = false
+	_, err = client.AllDetails(context.Background(), "20250701")
+	r.ErrorAs(t, err, &errs)
+}
+
+func TestUpstreamQueryVariables(t *testing.T) {
+	var request struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+		w.Write([]byte(`{"data":{"vehiclePositions":[{"vehicleId":"1"}]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+
+	upstream := &api.Upstream{Client: client}
+	_, err = upstream.FetchByServiceDay(context.Background(), "20250701")
+	r.NoError(t, err)
+	r.Contains(t, request.Query, "query VehiclePositions(")
+	r.Equal(t, "20250701", request.Variables["serviceDate"])
+	r.Equal(t, "hu", request.Variables["language"])
+	r.Equal(t, 45.5, request.Variables["swLat"])
+
+	templates := api.DefaultTemplates()
+	r.NoError(t, templates.Add("suburban", "", "query Suburban($modes: [TransitMode]) { vehiclePositions(swLat: 47.3, swLon: 18.8, neLat: 47.7, neLon: 19.4, modes: $modes) { vehicleId } }"))
+	upstream.Query, err = templates.Get("suburban")
+	r.NoError(t, err)
+	upstream.Params = api.QueryParams{Modes: []string{"SUBURBAN_RAILWAY"}, Language: "en"}
+
+	data, err := upstream.FetchByServiceDay(context.Background(), "20250701")
+	r.NoError(t, err)
+	r.Len(t, data.VehiclePositions, 1)
+	r.Contains(t, request.Query, "query Suburban(")
+	r.Equal(t, []any{"SUBURBAN_RAILWAY"}, request.Variables["modes"])
+	r.Equal(t, "en", request.Variables["language"])
+	r.Equal(t, 48.7, request.Variables["neLat"])
+
+	_, err = templates.Get("missing")
+	r.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package api
+
+import "time"
+
+// CurrentStoptime returns the index of the next stop the vehicle arrives at,
+// or the last stop when all arrivals are in the past. -1 means no stoptimes.
+func (v *VehiclePositions) CurrentStoptime(now time.Time) int {
+	stoptimes := v.Trip.Stoptimes
+	if len(stoptimes) == 0 {
+		return -1
+	}
+
+	for i, stoptime := range stoptimes {
+		serviceDay := stoptime.ServiceDay
+		if serviceDay == 0 {
+			serviceDay = ServiceDayStart(now).Unix()
+		}
+		if serviceDay+stoptime.RealtimeArrival > now.Unix() {
+			return i
+		}
+	}
+
+	return len(stoptimes) - 1
+}
+
+// Delay is the current delay in seconds, taken from the nearest upcoming stoptime.
+func (v *VehiclePositions) Delay(now time.Time) int64 {
+	i := v.CurrentStoptime(now)
+	if i < 0 {
+		return 0
+	}
+
+	stoptime := v.Trip.Stoptimes[i]
+	if stoptime.ArrivalDelay != 0 {
+		return stoptime.ArrivalDelay
+	}
+	return stoptime.DepartureDelay
+}
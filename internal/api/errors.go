@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an entry of the "errors" array of a GraphQL response.
+type GraphQLError struct {
+	Extensions map[string]any    `json:"extensions,omitempty"`
+	Message    string            `json:"message"`
+	Locations  []GraphQLLocation `json:"locations,omitempty"`
+	Path       []any             `json:"path,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return "graphql: " + e.Message
+	}
+
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return fmt.Sprintf("graphql: %s (path: %s)", e.Message, strings.Join(path, "."))
+}
+
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// envelope is the part of a GraphQL response needed to detect errors.
+type envelope struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// checkErrors returns the GraphQL errors of the response body and whether
+// the body carries (partial) data next to them.
+func checkErrors(body []byte) (GraphQLErrors, bool) {
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, true
+	}
+
+	data := len(env.Data) > 0 && string(env.Data) != "null"
+	if len(env.Errors) == 0 {
+		return nil, data
+	}
+
+	return env.Errors, data
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// DecodePolyline decodes an encoded polyline (precision 5, as returned in
+// TripGeometry.Points and Geometry.points) into [lat, lon] pairs.
+func DecodePolyline(encoded string) ([][2]float64, error) {
+	var points [][2]float64
+	var lat, lon int
+	for i := 0; i < len(encoded); {
+		var deltas [2]int
+		for j := range deltas {
+			var result, shift int
+			for {
+				if i >= len(encoded) {
+					return nil, ErrInvalidPolyline
+				}
+				b := int(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, ErrInvalidPolyline
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lon += deltas[1]
+		points = append(points, [2]float64{float64(lat) / 1e5, float64(lon) / 1e5})
+	}
+	return points, nil
+}
+
+// EncodePolyline is the inverse of DecodePolyline.
+func EncodePolyline(points [][2]float64) string {
+	var encoded []byte
+	var previous [2]int
+	for _, point := range points {
+		for j, value := range point {
+			current := int(math.Round(value * 1e5))
+			delta := current - previous[j]
+			previous[j] = current
+
+			v := delta << 1
+			if delta < 0 {
+				v = ^v
+			}
+			for v >= 0x20 {
+				encoded = append(encoded, byte((0x20|v&0x1f)+63))
+				v >>= 5
+			}
+			encoded = append(encoded, byte(v+63))
+		}
+	}
+	return string(encoded)
+}
@@ -0,0 +1,32 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	// The example of the polyline algorithm documentation.
+	points, err := api.DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	r.NoError(t, err)
+	r.Equal(t, [][2]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, points)
+
+	points, err = api.DecodePolyline("")
+	r.NoError(t, err)
+	r.Empty(t, points)
+
+	_, err = api.DecodePolyline("_p~iF~ps|")
+	r.ErrorIs(t, err, api.ErrInvalidPolyline)
+}
+
+func TestEncodePolyline(t *testing.T) {
+	r.Equal(t, "_p~iF~ps|U_ulLnnqC_mqNvxq`@", api.EncodePolyline([][2]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}))
+	r.Empty(t, api.EncodePolyline(nil))
+
+	points := [][2]float64{{47.49801, 19.03991}, {47.5, 19.04}, {46.25301, 20.14824}}
+	decoded, err := api.DecodePolyline(api.EncodePolyline(points))
+	r.NoError(t, err)
+	r.Equal(t, points, decoded)
+}
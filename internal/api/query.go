@@ -0,0 +1,123 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	DefaultTemplate = "vehiclePositions"
+	DefaultLanguage = "hu"
+)
+
+//go:embed queries/*.graphql
+var queries embed.FS
+
+var (
+	// DefaultBBox covers Hungary and the cross-border sections.
+	DefaultBBox  = BBox{SwLat: 45.5, SwLon: 16.1, NeLat: 48.7, NeLon: 22.8}
+	DefaultModes = []string{"TRAM", "RAIL", "RAIL_REPLACEMENT_BUS", "SUBURBAN_RAILWAY", "TRAMTRAIN"}
+)
+
+type BBox struct {
+	SwLat float64 `json:"swLat"`
+	SwLon float64 `json:"swLon"`
+	NeLat float64 `json:"neLat"`
+	NeLon float64 `json:"neLon"`
+}
+
+func (b BBox) IsZero() bool {
+	return b == BBox{}
+}
+
+// QueryParams are passed to the query templates as GraphQL variables.
+type QueryParams struct {
+	BBox     BBox
+	Modes    []string
+	Language string
+}
+
+func DefaultParams() QueryParams {
+	return QueryParams{
+		BBox:     DefaultBBox,
+		Modes:    DefaultModes,
+		Language: DefaultLanguage,
+	}
+}
+
+// WithDefaults fills the unset parameters from DefaultParams.
+func (p QueryParams) WithDefaults() QueryParams {
+	defaults := DefaultParams()
+	if p.BBox.IsZero() {
+		p.BBox = defaults.BBox
+	}
+	if len(p.Modes) == 0 {
+		p.Modes = defaults.Modes
+	}
+	if p.Language == "" {
+		p.Language = defaults.Language
+	}
+	return p
+}
+
+func (p QueryParams) Variables(serviceDate string) map[string]any {
+	return map[string]any{
+		"swLat":       p.BBox.SwLat,
+		"swLon":       p.BBox.SwLon,
+		"neLat":       p.BBox.NeLat,
+		"neLon":       p.BBox.NeLon,
+		"modes":       p.Modes,
+		"language":    p.Language,
+		"serviceDate": serviceDate,
+	}
+}
+
+// Templates maps template names to GraphQL documents.
+type Templates map[string]string
+
+// DefaultTemplates returns the bundled templates, named after their file.
+func DefaultTemplates() Templates {
+	templates := make(Templates)
+	entries, _ := queries.ReadDir("queries")
+	for _, entry := range entries {
+		data, err := queries.ReadFile(path.Join("queries", entry.Name()))
+		if err != nil {
+			continue
+		}
+		templates[strings.TrimSuffix(entry.Name(), ".graphql")] = string(data)
+	}
+	return templates
+}
+
+// Add registers a template from an inline query or, when query is empty, a file.
+func (t Templates) Add(name, file, query string) error {
+	if name == "" {
+		return fmt.Errorf("query template without name")
+	}
+	if query == "" {
+		if file == "" {
+			return fmt.Errorf("query template %s: missing query or file", name)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("query template %s: %w", name, err)
+		}
+		query = string(data)
+	}
+	t[name] = query
+	return nil
+}
+
+func (t Templates) Get(name string) (string, error) {
+	if name == "" {
+		name = DefaultTemplate
+	}
+	query, ok := t[name]
+	if !ok {
+		return "", fmt.Errorf("unknown query template: %s", name)
+	}
+	return query, nil
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// The reference datasets and the templates they are fetched with.
+const (
+	ReferenceStops    = "stops"
+	ReferenceStations = "stations"
+	ReferenceRoutes   = "routes"
+	ReferencePatterns = "patterns"
+	ReferenceAgencies = "agencies"
+	ReferenceFeeds    = "feeds"
+)
+
+type GtfsRef struct {
+	GtfsID string `json:"gtfsId"`
+}
+
+type ReferenceStop struct {
+	ParentStation      *GtfsRef `json:"parentStation,omitempty"`
+	GtfsID             string   `json:"gtfsId"`
+	Name               string   `json:"name"`
+	Code               string   `json:"code,omitempty"`
+	PlatformCode       string   `json:"platformCode,omitempty"`
+	LocationType       string   `json:"locationType,omitempty"`
+	VehicleMode        string   `json:"vehicleMode,omitempty"`
+	ZoneID             string   `json:"zoneId,omitempty"`
+	WheelchairBoarding string   `json:"wheelchairBoarding,omitempty"`
+	Lat                float64  `json:"lat"`
+	Lon                float64  `json:"lon"`
+}
+
+type ReferenceStation struct {
+	GtfsID string    `json:"gtfsId"`
+	Name   string    `json:"name"`
+	Stops  []GtfsRef `json:"stops,omitempty"`
+	Lat    float64   `json:"lat"`
+	Lon    float64   `json:"lon"`
+}
+
+type ReferenceRoute struct {
+	Agency    *GtfsRef `json:"agency,omitempty"`
+	GtfsID    string   `json:"gtfsId"`
+	ShortName string   `json:"shortName,omitempty"`
+	LongName  string   `json:"longName,omitempty"`
+	Mode      string   `json:"mode,omitempty"`
+	Color     string   `json:"color,omitempty"`
+	TextColor string   `json:"textColor,omitempty"`
+	Type      int      `json:"type,omitempty"`
+}
+
+type ReferencePattern struct {
+	Route       GtfsRef      `json:"route"`
+	ID          string       `json:"id"`
+	Code        string       `json:"code"`
+	Name        string       `json:"name,omitempty"`
+	Headsign    string       `json:"headsign,omitempty"`
+	Stops       []GtfsRef    `json:"stops,omitempty"`
+	Geometry    [][2]float64 `json:"geometry,omitempty"`
+	Length      int          `json:"length,omitempty"`
+	DirectionID int          `json:"directionId"`
+}
+
+type ReferenceAgency struct {
+	GtfsID   string `json:"gtfsId"`
+	Name     string `json:"name"`
+	URL      string `json:"url,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Lang     string `json:"lang,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+}
+
+type ReferenceFeed struct {
+	FeedID   string    `json:"feedId"`
+	Agencies []GtfsRef `json:"agencies,omitempty"`
+}
+
+// Reference is the static network data, one field per dataset.
+type Reference struct {
+	Stops    []ReferenceStop
+	Stations []ReferenceStation
+	Routes   []ReferenceRoute
+	Patterns []ReferencePattern
+	Agencies []ReferenceAgency
+	Feeds    []ReferenceFeed
+}
+
+type referencePattern struct {
+	ReferencePattern
+	PatternGeometry *TripGeometry `json:"patternGeometry"`
+}
+
+type referenceResponse struct {
+	Data struct {
+		Stops    []ReferenceStop    `json:"stops"`
+		Stations []ReferenceStation `json:"stations"`
+		Routes   []ReferenceRoute   `json:"routes"`
+		Patterns []referencePattern `json:"patterns"`
+		Agencies []ReferenceAgency  `json:"agencies"`
+		Feeds    []ReferenceFeed    `json:"feeds"`
+	} `json:"data"`
+}
+
+// FetchReference fetches every reference dataset with its template, one
+// request per dataset. Partial data is not accepted for reference data.
+func (e *Upstream) FetchReference(ctx context.Context, templates Templates, language string) (Reference, error) {
+	if language == "" {
+		language = DefaultLanguage
+	}
+
+	var result referenceResponse
+	for _, dataset := range []string{ReferenceStops, ReferenceStations, ReferenceRoutes, ReferencePatterns, ReferenceAgencies, ReferenceFeeds} {
+		query, err := templates.Get(dataset)
+		if err != nil {
+			return Reference{}, err
+		}
+
+		var variables map[string]any
+		if dataset == ReferenceRoutes {
+			variables = map[string]any{"language": language}
+		}
+
+		client := *e.Client
+		client.AllowPartial = false
+		if _, err := client.decode(ctx, query, variables, &result); err != nil {
+			return Reference{}, fmt.Errorf("%s: %w", dataset, err)
+		}
+	}
+
+	reference := Reference{
+		Stops:    result.Data.Stops,
+		Stations: result.Data.Stations,
+		Routes:   result.Data.Routes,
+		Agencies: result.Data.Agencies,
+		Feeds:    result.Data.Feeds,
+	}
+
+	for _, p := range result.Data.Patterns {
+		pattern := p.ReferencePattern
+		if p.PatternGeometry != nil {
+			geometry, err := DecodePolyline(p.PatternGeometry.Points)
+			if err != nil {
+				return Reference{}, fmt.Errorf("pattern %s: %w", pattern.ID, err)
+			}
+			pattern.Geometry = geometry
+			pattern.Length = p.PatternGeometry.Length
+		}
+		reference.Patterns = append(reference.Patterns, pattern)
+	}
+
+	return reference, nil
+}
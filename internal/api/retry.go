@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	RetryTimeout    = "timeout"
+	RetryConnection = "connection"
+	RetryEOF        = "eof"
+	RetryGraphQL    = "graphql"
+
+	DefaultMaxBackoff = time.Minute
+)
+
+var (
+	DefaultRetryStatuses = []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	DefaultRetryErrors   = []string{RetryTimeout, RetryConnection, RetryEOF}
+)
+
+// RetryPolicy controls how Client.Do retries failed requests. MaxAttempts
+// below 2 disables retrying.
+type RetryPolicy struct {
+	Statuses    []int
+	Errors      []string
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Deadline    time.Duration
+}
+
+type StatusError struct {
+	Status     string
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status: %s", e.Status)
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	err := &StatusError{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds and HTTP-date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		statuses := p.Statuses
+		if len(statuses) == 0 {
+			statuses = DefaultRetryStatuses
+		}
+		return slices.Contains(statuses, statusErr.StatusCode)
+	}
+
+	kinds := p.Errors
+	if len(kinds) == 0 {
+		kinds = DefaultRetryErrors
+	}
+
+	var graphqlErrs GraphQLErrors
+	if errors.As(err, &graphqlErrs) {
+		return slices.Contains(kinds, RetryGraphQL)
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return slices.Contains(kinds, RetryTimeout)
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return slices.Contains(kinds, RetryEOF)
+	case errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.As(err, new(*net.OpError)):
+		return slices.Contains(kinds, RetryConnection)
+	}
+
+	return false
+}
+
+// Backoff returns the wait before the given (1-based) retry using full
+// jitter: a random duration between 0 and min(MaxBackoff, BaseBackoff*2^(retry-1)).
+// MaxBackoff defaults to DefaultMaxBackoff.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	base := p.BaseBackoff
+	if base <= 0 {
+		base = time.Second
+	}
+	ceiling := p.MaxBackoff
+	if ceiling <= 0 {
+		ceiling = DefaultMaxBackoff
+	}
+
+	// Doubling stops at the ceiling, so the shift cannot overflow.
+	if shift := retry - 1; shift >= 0 && shift < 63 && base <= ceiling>>shift {
+		ceiling = base << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// wait returns how long to wait before the next attempt, honouring Retry-After.
+func (p RetryPolicy) wait(retry int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+	return p.Backoff(retry)
+}
@@ -3,9 +3,11 @@ package api
 import "encoding/json"
 
 type OTPResponse struct {
-	Data Data `json:"data,omitempty"`
+	Data   Data          `json:"data,omitempty"`
+	Errors GraphQLErrors `json:"errors,omitempty"`
 }
 type Stop struct {
+	GtfsID       string  `json:"gtfsId,omitempty"`
 	Name         string  `json:"name"`
 	PlatformCode string  `json:"platformCode"`
 	Lat          float64 `json:"lat"`
@@ -31,12 +33,14 @@ type ArrivalStoptime struct {
 
 type Stoptimes struct {
 	Stop               Stop  `json:"stop,omitempty"`
+	StopPosition       *int  `json:"stopPosition,omitempty"`
 	RealtimeArrival    int64 `json:"realtimeArrival"`
 	RealtimeDeparture  int64 `json:"realtimeDeparture"`
 	ArrivalDelay       int64 `json:"arrivalDelay"`
 	DepartureDelay     int64 `json:"departureDelay"`
 	ScheduledArrival   int64 `json:"scheduledArrival"`
 	ScheduledDeparture int64 `json:"scheduledDeparture"`
+	ServiceDay         int64 `json:"serviceDay,omitempty"`
 }
 type TripGeometry struct {
 	Points string `json:"points,omitempty"`
@@ -87,6 +91,10 @@ type Trip struct {
 	Alerts                 []Alerts        `json:"alerts"`
 	ArrivalStoptime        ArrivalStoptime `json:"arrivalStoptime"`
 	TrainCategoryBaseID    int64           `json:"trainCategoryBaseId,omitempty"`
+	// Cancelled is set when the trip is (partially) cancelled, CancelledStops
+	// are the gtfsIds of the cancelled stops.
+	Cancelled      bool     `json:"cancelled,omitempty"`
+	CancelledStops []string `json:"cancelledStops,omitempty"`
 }
 type VehiclePositions struct {
 	StopRelationship StopRelationship `json:"stopRelationship,omitempty"`
@@ -109,6 +117,11 @@ type Holavonat struct {
 	Timestamp        string             `json:"timestamp"`
 	VehiclePositions []VehiclePositions `json:"vehiclePositions"`
 	LastUpdated      int64              `json:"lastUpdated"`
+	Errors           GraphQLErrors      `json:"errors,omitempty"`
+	// MissingAreas are the tiles that failed to load in this snapshot.
+	MissingAreas []BBox `json:"missingAreas,omitempty"`
+	// Sequence numbers the snapshot for the delta feed.
+	Sequence int64 `json:"sequence,omitempty"`
 }
 
 func (v *Holavonat) Json() ([]byte, error) {
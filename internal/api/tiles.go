@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	log "github.com/holavonat/holavonatis/internal/logger"
+)
+
+// Split divides the box into n tiles on a grid as close to square as n
+// allows, with more columns than rows.
+func (b BBox) Split(n int) []BBox {
+	if n <= 1 {
+		return []BBox{b}
+	}
+
+	rows := 1
+	for i := 1; i <= int(math.Sqrt(float64(n))); i++ {
+		if n%i == 0 {
+			rows = i
+		}
+	}
+	cols := n / rows
+
+	height := (b.NeLat - b.SwLat) / float64(rows)
+	width := (b.NeLon - b.SwLon) / float64(cols)
+
+	tiles := make([]BBox, 0, n)
+	for row := range rows {
+		for col := range cols {
+			tile := BBox{
+				SwLat: b.SwLat + float64(row)*height,
+				SwLon: b.SwLon + float64(col)*width,
+				NeLat: b.SwLat + float64(row+1)*height,
+				NeLon: b.SwLon + float64(col+1)*width,
+			}
+			// Avoid rounding gaps on the outer edges.
+			if row == rows-1 {
+				tile.NeLat = b.NeLat
+			}
+			if col == cols-1 {
+				tile.NeLon = b.NeLon
+			}
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles
+}
+
+func (b BBox) String() string {
+	return fmt.Sprintf("%g,%g,%g,%g", b.SwLat, b.SwLon, b.NeLat, b.NeLon)
+}
+
+// fetchTiles queries the tiles of the bbox with at most workers requests in
+// flight and merges the vehicles. It only fails when every tile failed, the
+// areas of the failed tiles are returned otherwise.
+func (e *Upstream) fetchTiles(ctx context.Context, query, serviceDay string) (OTPResponse, []BBox, error) {
+	params := e.Params.WithDefaults()
+	tiles := params.BBox.Split(e.Tiles)
+
+	workers := e.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	responses := make([]OTPResponse, len(tiles))
+	errs := make([]error, len(tiles))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, tile := range tiles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			tileParams := params
+			tileParams.BBox = tile
+			responses[i], errs[i] = e.Client.VehiclePositions(ctx, query, tileParams.Variables(serviceDay))
+		}()
+	}
+	wg.Wait()
+
+	var merged OTPResponse
+	var missing []BBox
+	var failed []error
+	index := make(map[string]int)
+	for i, response := range responses {
+		if errs[i] != nil {
+			missing = append(missing, tiles[i])
+			failed = append(failed, fmt.Errorf("tile %s: %w", tiles[i], errs[i]))
+			continue
+		}
+
+		merged.Errors = append(merged.Errors, response.Errors...)
+		for _, vehicle := range response.Data.VehiclePositions {
+			if vehicle.VehicleID == "" {
+				merged.Data.VehiclePositions = append(merged.Data.VehiclePositions, vehicle)
+				continue
+			}
+			if j, ok := index[vehicle.VehicleID]; ok {
+				if vehicle.LastUpdated > merged.Data.VehiclePositions[j].LastUpdated {
+					merged.Data.VehiclePositions[j] = vehicle
+				}
+				continue
+			}
+			index[vehicle.VehicleID] = len(merged.Data.VehiclePositions)
+			merged.Data.VehiclePositions = append(merged.Data.VehiclePositions, vehicle)
+		}
+	}
+
+	if len(missing) == len(tiles) {
+		return OTPResponse{}, nil, errors.Join(failed...)
+	}
+	if len(missing) > 0 {
+		log.New("api").Warnw("Some tiles failed, publishing the rest", "failed", len(missing), "tiles", len(tiles), "error", errors.Join(failed...))
+	}
+
+	return merged, missing, nil
+}
@@ -0,0 +1,63 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	tiles := api.DefaultBBox.Split(6)
+	r.Len(t, tiles, 6)
+	r.Equal(t, api.DefaultBBox.SwLat, tiles[0].SwLat)
+	r.Equal(t, api.DefaultBBox.SwLon, tiles[0].SwLon)
+	r.Equal(t, api.DefaultBBox.NeLat, tiles[5].NeLat)
+	r.Equal(t, api.DefaultBBox.NeLon, tiles[5].NeLon)
+	r.Equal(t, tiles[0].NeLon, tiles[1].SwLon)
+	r.Equal(t, tiles[0].NeLat, tiles[3].SwLat)
+
+	r.Len(t, api.DefaultBBox.Split(5), 5)
+	r.Equal(t, []api.BBox{api.DefaultBBox}, api.DefaultBBox.Split(0))
+}
+
+func TestFetchTiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request struct {
+			Variables map[string]float64 `json:"variables"`
+		}
+		json.NewDecoder(req.Body).Decode(&request)
+
+		switch request.Variables["swLon"] {
+		case api.DefaultBBox.SwLon:
+			// The shared vehicle is older in the western tile.
+			fmt.Fprint(w, `{"data":{"vehiclePositions":[{"vehicleId":"1","lastUpdated":100},{"vehicleId":"shared","lastUpdated":100,"lat":1}]}}`)
+		case api.DefaultBBox.Split(3)[1].SwLon:
+			fmt.Fprint(w, `{"data":{"vehiclePositions":[{"vehicleId":"shared","lastUpdated":200,"lat":2},{"vehicleId":"2","lastUpdated":100}]}}`)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := api.NewClientCustomHTTP(srv.URL, map[string]string{}, srv.Client())
+	r.NoError(t, err)
+
+	upstream := &api.Upstream{Client: client, Tiles: 3, Workers: 2}
+	data, err := upstream.FetchByServiceDay(context.Background(), "20250701")
+	r.NoError(t, err)
+	r.Len(t, data.VehiclePositions, 3)
+	r.Equal(t, "shared", data.VehiclePositions[1].VehicleID)
+	r.Equal(t, 2.0, data.VehiclePositions[1].Lat)
+	r.Equal(t, []api.BBox{api.DefaultBBox.Split(3)[2]}, data.MissingAreas)
+
+	upstream.Params.BBox = api.BBox{SwLat: 47, SwLon: 18, NeLat: 48, NeLon: 19}
+	_, err = upstream.FetchByServiceDay(context.Background(), "20250701")
+	var statusErr *api.StatusError
+	r.ErrorAs(t, err, &statusErr)
+}
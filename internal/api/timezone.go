@@ -0,0 +1,27 @@
+package api
+
+import (
+	"time"
+	_ "time/tzdata"
+)
+
+const TimeZone = "Europe/Budapest"
+
+// Location is the time zone of the upstream schedules.
+var Location = mustLoadLocation(TimeZone)
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+// ServiceDayStart is the reference time of the service day containing t
+// (noon minus 12h, as in GTFS), the stoptime seconds are relative to it.
+func ServiceDayStart(t time.Time) time.Time {
+	local := t.In(Location)
+	noon := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, Location)
+	return noon.Add(-12 * time.Hour)
+}
@@ -1,17 +1,25 @@
 package api
 
 import (
+	"context"
 	"time"
 )
 
 type Upstream struct {
 	Client *Client
 	Source Source
+	// Query is the vehiclePositions template, the bundled one when empty.
+	Query  string
+	Params QueryParams
+	// Tiles splits the bbox into that many tiles fetched by at most Workers
+	// concurrent requests, 0 or 1 fetches the whole bbox at once.
+	Tiles   int
+	Workers int
 }
 
-func (e *Upstream) Fetch() (Holavonat, error) {
+func (e *Upstream) Fetch(ctx context.Context) (Holavonat, error) {
 	serviceDay := time.Now().Format("20060102")
-	details, err := e.Client.AllDetails(serviceDay)
+	details, missing, err := e.details(ctx, serviceDay)
 	if err != nil {
 		return Holavonat{}, err
 	}
@@ -20,11 +28,13 @@ func (e *Upstream) Fetch() (Holavonat, error) {
 		VehiclePositions: details.Data.VehiclePositions,
 		LastUpdated:      time.Now().Unix(),
 		Timestamp:        time.Now().Format(time.RFC3339),
+		Errors:           details.Errors,
+		MissingAreas:     missing,
 	}, nil
 }
 
-func (e *Upstream) FetchByServiceDay(serviceDay string) (Holavonat, error) {
-	details, err := e.Client.AllDetails(serviceDay)
+func (e *Upstream) FetchByServiceDay(ctx context.Context, serviceDay string) (Holavonat, error) {
+	details, missing, err := e.details(ctx, serviceDay)
 	if err != nil {
 		return Holavonat{}, err
 	}
@@ -35,5 +45,25 @@ func (e *Upstream) FetchByServiceDay(serviceDay string) (Holavonat, error) {
 		LastUpdated:      time.Now().Unix(),
 		Timestamp:        time.Now().Format(time.RFC3339),
 		Source:           e.Source,
+		Errors:           details.Errors,
+		MissingAreas:     missing,
 	}, nil
 }
+
+func (e *Upstream) details(ctx context.Context, serviceDay string) (OTPResponse, []BBox, error) {
+	if err := validateServiceDay(serviceDay); err != nil {
+		return OTPResponse{}, nil, err
+	}
+
+	query := e.Query
+	if query == "" {
+		query = DefaultTemplates()[DefaultTemplate]
+	}
+
+	if e.Tiles > 1 {
+		return e.fetchTiles(ctx, query, serviceDay)
+	}
+
+	details, err := e.Client.VehiclePositions(ctx, query, e.Params.WithDefaults().Variables(serviceDay))
+	return details, nil, err
+}
@@ -0,0 +1,325 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/cloudflare"
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/flat"
+	"github.com/holavonat/holavonatis/internal/geojson"
+	"github.com/holavonat/holavonatis/internal/gtfsrt"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/metrics"
+	"github.com/holavonat/holavonatis/internal/normalized"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/replay"
+	"gopkg.in/yaml.v3"
+)
+
+// Replay publishes the archived snapshots of a sink through the configured
+// outputs and the stream instead of querying the upstream. Archiving and the
+// stores that accumulate data (Parquet, history, events, punctuality and the
+// daily flat files) stay off, so replayed data does not mix with the real one.
+func Replay(ctx context.Context, cfg config.Config, assets fs.FS, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := flags.String("from", "", "first snapshot, RFC 3339 time or YYYY-MM-DD")
+	to := flags.String("to", "", "last snapshot, RFC 3339 time or YYYY-MM-DD (default: now)")
+	speed := flags.Float64("speed", 1, "playback speed, 0 publishes without waiting")
+	step := flags.Bool("step", false, "wait for Enter before each snapshot")
+	source := flags.String("source", "", "sink to read the archives from (default: the first sink)")
+	sinks := flags.String("sinks", "", "comma separated sinks to publish to besides the HTTP server (default: none)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" {
+		return errors.New("missing -from")
+	}
+	if *speed < 0 {
+		return fmt.Errorf("invalid speed: %v", *speed)
+	}
+	start, end, err := replay.ParseRange(*from, *to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if *source == "" && len(cfg.Sinks) > 0 {
+		*source = cfg.Sinks[0].Name
+	}
+	var targets []string
+	if *sinks != "" {
+		targets = strings.Split(*sinks, ",")
+	}
+	for _, target := range targets {
+		if !slices.ContainsFunc(cfg.Sinks, func(sink config.Sink) bool { return sink.Name == target }) {
+			return fmt.Errorf("unknown sink: %q", target)
+		}
+		if target == *source {
+			return fmt.Errorf("sink %q is the replay source, it cannot be published to", target)
+		}
+	}
+	if targets == nil && cfg.Server.Listen == "" {
+		return errors.New("nothing to publish to, set -sinks or enable the HTTP server")
+	}
+
+	l := log.New("replay")
+	cfg.Output.Archive = false
+	cfg.Output.Flat.Daily = false
+	cfg.Output.Format.Parquet = false
+	app := config.App{
+		Cfg:    cfg,
+		Assets: assets,
+	}
+
+	app.Publisher.Observer = metrics.Recorder{}
+
+	player := replay.Player{
+		Speed: *speed,
+		Publish: func(ctx context.Context, data api.Holavonat, timestamp string) error {
+			return Process(ctx, &app, &data, timestamp)
+		},
+	}
+	if *step {
+		player.Step = os.Stdin
+	}
+
+	for _, sink := range cfg.Sinks {
+		isSource := sink.Name == *source
+		publish := slices.Contains(targets, sink.Name)
+		if !isSource && !publish {
+			continue
+		}
+
+		destination, err := NewDestination(sink)
+		if err != nil {
+			return fmt.Errorf("failed to create sink %s: %w", sink.Name, err)
+		}
+		if isSource {
+			player.Source = destination.Sink
+			l.Infow("Reading archives from sink", "sink", sink.Name, "type", sink.Type)
+		}
+		if publish {
+			app.Publisher.Destinations = append(app.Publisher.Destinations, destination)
+			l.Infow("Using sink for output", "sink", sink.Name, "type", sink.Type)
+		}
+	}
+	if player.Source == nil {
+		return fmt.Errorf("unknown source sink: %q", *source)
+	}
+
+	if err := NewFormats(ctx, &app); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if cfg.Server.Listen != "" {
+		srv, err := NewServer(&app)
+		if err != nil {
+			return fmt.Errorf("failed to create HTTP server: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Infow("Starting HTTP server", "listen", cfg.Server.Listen, "static", cfg.Server.Static)
+			if err := srv.ListenAndServe(ctx, cfg.Server.Listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.Errorw("HTTP server stopped", "error", err)
+			}
+		}()
+	}
+
+	archives, err := replay.List(ctx, player.Source, cfg.Output.NamePrefix, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to list archives: %w", err)
+	}
+	l.Infow("Replaying archives", "count", len(archives), "from", start.Format(time.RFC3339), "to", end.Format(time.RFC3339), "speed", *speed, "step", *step)
+
+	if err := player.Play(ctx, archives); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	if cfg.Server.Listen != "" && ctx.Err() == nil {
+		l.Infow("Replay finished, serving the last snapshot until stopped")
+		<-ctx.Done()
+	}
+	return nil
+}
+
+// Convert writes an archived JSON snapshot, read from a file or from stdin
+// with -, in another output format.
+func Convert(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	format := flags.String("format", "geojson", "json, geojson, gtfsrt, v4, csv, ndjson or parquet")
+	feed := flags.String("feed", "vehicle_positions", "GTFS-RT feed: vehicle_positions, trip_updates or alerts")
+	table := flags.String("table", columnar.TablePositions, "Parquet table: positions or stoptimes")
+	columns := flags.String("columns", "", "comma separated CSV and NDJSON columns (default: the default columns)")
+	out := flags.String("o", "", "output file (default: stdout)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: holavonatis convert [flags] <snapshot.json[.gz|.br|.zst]|->")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one snapshot file")
+	}
+
+	name := flags.Arg(0)
+	var raw []byte
+	var err error
+	if name == "-" {
+		raw, err = io.ReadAll(stdin)
+	} else {
+		raw, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return err
+	}
+	if raw, err = output.Decompress(raw, output.Encoding(name)); err != nil {
+		return err
+	}
+
+	var data api.Holavonat
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	var names []string
+	if *columns != "" {
+		names = strings.Split(*columns, ",")
+	}
+
+	var result []byte
+	switch *format {
+	case "json":
+		result, err = data.Json()
+	case "geojson":
+		result, err = geojson.Encode(data)
+	case "gtfsrt":
+		var feeds gtfsrt.Feeds
+		if feeds, err = gtfsrt.Encode(data); err != nil {
+			break
+		}
+		switch *feed {
+		case "vehicle_positions":
+			result = feeds.VehiclePositions
+		case "trip_updates":
+			result = feeds.TripUpdates
+		case "alerts":
+			result = feeds.Alerts
+		default:
+			return fmt.Errorf("unknown GTFS-RT feed: %s", *feed)
+		}
+	case "v4":
+		snapshot, dictionaries := (&normalized.Encoder{}).Encode(data)
+		if dictionaries != nil {
+			snapshot.Stops = dictionaries.Stops
+			snapshot.Geometries = dictionaries.Geometries
+		}
+		result, err = json.Marshal(snapshot)
+	case "csv", "ndjson":
+		positions, err := flat.NewPositions(names)
+		if err != nil {
+			return err
+		}
+		rows := columnar.Positions(data)
+		if *format == "ndjson" {
+			result, err = positions.NDJSON(rows)
+		} else if result, err = positions.CSV(rows); err == nil {
+			result = append(positions.CSVHeader(), result...)
+		}
+		if err != nil {
+			return err
+		}
+	case "parquet":
+		switch *table {
+		case columnar.TablePositions:
+			result, err = columnar.Encode(columnar.Positions(data))
+		case columnar.TableStoptimes:
+			result, err = columnar.Encode(columnar.Stoptimes(data))
+		default:
+			return fmt.Errorf("unknown Parquet table: %s", *table)
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		return os.WriteFile(*out, result, 0o644)
+	}
+	_, err = stdout.Write(result)
+	return err
+}
+
+// ValidateConfig checks the parts of cfg that are only parsed when used and
+// prints the effective config with the secrets redacted.
+func ValidateConfig(cfg config.Config, stdout io.Writer) error {
+	if _, _, err := NewQuery(cfg); err != nil {
+		return fmt.Errorf("failed to load query template: %w", err)
+	}
+
+	if cfg.Cron.Mode == config.Schedule {
+		if _, err := NewSchedule(cfg); err != nil {
+			return fmt.Errorf("failed to parse schedule: %w", err)
+		}
+	}
+
+	if cfg.Output.Format.NDJSON || cfg.Output.Format.CSV {
+		if _, err := flat.NewPositions(cfg.Output.Flat.Columns); err != nil {
+			return fmt.Errorf("invalid flat output columns: %w", err)
+		}
+	}
+
+	raw, err := yaml.Marshal(config.Redact(cfg))
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(raw)
+	return err
+}
+
+// Trace prints the Cloudflare trace of the direct connection and, with a
+// proxy configured, of the proxied one.
+func Trace(cfg config.Config, stdout io.Writer) error {
+	direct, err := cloudflare.GetTrace(&http.Client{})
+	if err != nil {
+		return fmt.Errorf("failed to get trace: %w", err)
+	}
+	traces := map[string]cloudflare.Trace{"direct": direct}
+
+	if cfg.Network.Proxy != "" {
+		proxy, err := cloudflare.GetTraceProxy(&http.Client{}, cfg.Network.Proxy)
+		if err != nil {
+			return fmt.Errorf("failed to get trace with proxy: %w", err)
+		}
+		if proxy.Ip == direct.Ip {
+			log.New("main").Warnw("Proxy IP matches public IP, this may not be a valid proxy", "proxy", config.Redact(cfg).Network.Proxy, "public_ip", direct.Ip)
+		}
+		traces["proxy"] = proxy
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(traces)
+}
@@ -0,0 +1,106 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/app"
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/normalized"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/parquet-go/parquet-go"
+	r "github.com/stretchr/testify/require"
+)
+
+var lastUpdated = time.Date(2025, 7, 1, 8, 0, 0, 0, api.Location).Unix()
+
+func snapshot() api.Holavonat {
+	return api.Holavonat{
+		LastUpdated: lastUpdated,
+		VehiclePositions: []api.VehiclePositions{{
+			VehicleID: "v1",
+			Lat:       47.5,
+			Lon:       19.04,
+			Trip: api.Trip{
+				GtfsID:     "1:t1",
+				TripNumber: "2612",
+				Stoptimes: []api.Stoptimes{
+					{Stop: api.Stop{GtfsID: "1:a", Name: "A"}, ScheduledArrival: 8 * 3600},
+					{Stop: api.Stop{GtfsID: "1:b", Name: "B"}, ScheduledArrival: 9 * 3600},
+				},
+			},
+		}},
+	}
+}
+
+func convert(t *testing.T, input []byte, args ...string) []byte {
+	var stdout bytes.Buffer
+	r.NoError(t, app.Convert(append(args, "-"), bytes.NewReader(input), &stdout))
+	return stdout.Bytes()
+}
+
+func TestConvert(t *testing.T) {
+	raw, err := json.Marshal(snapshot())
+	r.NoError(t, err)
+
+	var data api.Holavonat
+	r.NoError(t, json.Unmarshal(convert(t, raw, "-format", "json"), &data))
+	r.Equal(t, snapshot(), data)
+
+	// A compressed archive is recognized by its suffix.
+	compressed, _, err := output.Compress(raw, output.EncodingGzip)
+	r.NoError(t, err)
+	name := filepath.Join(t.TempDir(), "data_2025-07-01T08:00:00+02:00.json.gz")
+	r.NoError(t, os.WriteFile(name, compressed, 0o644))
+	var stdout bytes.Buffer
+	r.NoError(t, app.Convert([]string{"-format", "json", name}, nil, &stdout))
+	r.JSONEq(t, string(convert(t, raw, "-format", "json")), stdout.String())
+
+	var v4 normalized.Snapshot
+	r.NoError(t, json.Unmarshal(convert(t, raw, "-format", "v4"), &v4))
+	r.Equal(t, "1:b", v4.VehiclePositions[0].Trip.Stoptimes[1].Stop)
+	r.Equal(t, "B", v4.Stops["1:b"].Name)
+
+	var geojson struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	r.NoError(t, json.Unmarshal(convert(t, raw, "-format", "geojson"), &geojson))
+	r.Len(t, geojson.Features, 1)
+
+	csv := strings.Split(strings.TrimSpace(string(convert(t, raw, "-format", "csv", "-columns", "vehicle_id,trip_number"))), "\n")
+	r.Equal(t, []string{"vehicle_id,trip_number", "v1,2612"}, csv)
+
+	result := convert(t, raw, "-format", "parquet")
+	rows, err := parquet.Read[columnar.PositionRow](bytes.NewReader(result), int64(len(result)))
+	r.NoError(t, err)
+	r.Len(t, rows, 1)
+	r.Equal(t, "2612", rows[0].TripNumber)
+
+	r.Error(t, app.Convert([]string{"-format", "xml", "-"}, bytes.NewReader(raw), &stdout))
+	r.Error(t, app.Convert([]string{"-"}, strings.NewReader("not json"), &stdout))
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg := config.Config{
+		GraphqlEndpoint: "https://example.com/graphql",
+		Cron:            config.Cron{Mode: config.Fix},
+		ObjectStorage:   config.ObjectStorage{AccessKeyID: "key-id", SecretAccessKey: "top-secret-key"},
+	}
+
+	var stdout bytes.Buffer
+	r.NoError(t, app.ValidateConfig(cfg, &stdout))
+	r.Contains(t, stdout.String(), "https://example.com/graphql")
+	r.Contains(t, stdout.String(), config.Redacted)
+	r.NotContains(t, stdout.String(), "top-secret-key")
+
+	cfg.Output.Format.CSV = true
+	cfg.Output.Flat.Columns = []string{"no_such_column"}
+	r.ErrorContains(t, app.ValidateConfig(cfg, &stdout), "invalid flat output columns")
+}
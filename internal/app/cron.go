@@ -0,0 +1,308 @@
+package app
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/config"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/metrics"
+	"github.com/holavonat/holavonatis/internal/schedule"
+)
+
+func Multiplier(duration config.TimeFrame) time.Duration {
+	switch duration {
+	case config.Second:
+		return time.Second
+	case config.Minute:
+		return time.Minute
+	case config.Hour:
+		return time.Hour
+	default:
+		return time.Second
+	}
+}
+
+// MinInterval is the shortest possible sleep between two scheduled runs.
+func MinInterval(cfg config.Config) time.Duration {
+	switch cfg.Cron.Mode {
+	case config.Window:
+		return time.Duration(cfg.Cron.Window.Min) * Multiplier(cfg.Cron.Duration)
+	case config.Adaptive:
+		return time.Duration(cfg.Cron.Adaptive.Min) * Multiplier(cfg.Cron.Duration)
+	case config.Schedule:
+		min, _ := ScheduleGaps(cfg)
+		return min
+	default:
+		return time.Duration(cfg.Cron.Fix.Interval) * Multiplier(cfg.Cron.Duration)
+	}
+}
+
+// MaxInterval is the longest possible sleep between two scheduled runs.
+func MaxInterval(cfg config.Config) time.Duration {
+	switch cfg.Cron.Mode {
+	case config.Window:
+		return time.Duration(cfg.Cron.Window.Max) * Multiplier(cfg.Cron.Duration)
+	case config.Adaptive:
+		return time.Duration(cfg.Cron.Adaptive.Max) * Multiplier(cfg.Cron.Duration)
+	case config.Schedule:
+		_, max := ScheduleGaps(cfg)
+		return max
+	default:
+		return time.Duration(cfg.Cron.Fix.Interval) * Multiplier(cfg.Cron.Duration)
+	}
+}
+
+// NewTemplates returns the bundled and the configured query templates.
+func NewTemplates(cfg config.Config) (api.Templates, error) {
+	templates := api.DefaultTemplates()
+	for _, template := range cfg.Query.Templates {
+		if err := templates.Add(template.Name, template.File, template.Query); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// NewQuery resolves the configured vehiclePositions template and its parameters.
+func NewQuery(cfg config.Config) (string, api.QueryParams, error) {
+	templates, err := NewTemplates(cfg)
+	if err != nil {
+		return "", api.QueryParams{}, err
+	}
+
+	query, err := templates.Get(cfg.Query.Template)
+	if err != nil {
+		return "", api.QueryParams{}, err
+	}
+
+	return query, api.QueryParams{
+		BBox:     cfg.Query.BBox,
+		Modes:    cfg.Query.Modes,
+		Language: cfg.Query.Language,
+	}.WithDefaults(), nil
+}
+
+func NewSchedule(cfg config.Config) (*schedule.Schedule, error) {
+	rules := make([]schedule.Rule, 0, len(cfg.Cron.Schedule.Rules))
+	for _, r := range cfg.Cron.Schedule.Rules {
+		rule, err := schedule.ParseRule(r.From, r.To, r.Interval)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return schedule.New(api.Location, cfg.Cron.Schedule.Expressions, rules)
+}
+
+// ScheduleGaps simulates the schedule for a week and returns the shortest and
+// longest sleep between two runs.
+func ScheduleGaps(cfg config.Config) (min, max time.Duration) {
+	s, err := NewSchedule(cfg)
+	if err != nil {
+		return 0, 0
+	}
+	return s.Gaps(time.Now(), 7*24*time.Hour)
+}
+
+// NewRetryPolicy builds the retry policy of the API client. When retrying is
+// enabled, the total deadline defaults to half of the shortest cron interval
+// and never reaches it, so a retried cycle does not overlap the next one.
+func NewRetryPolicy(cfg config.Config) api.RetryPolicy {
+	retry := cfg.Network.Retry
+	policy := api.RetryPolicy{
+		MaxAttempts: retry.MaxAttempts,
+		BaseBackoff: time.Duration(retry.BaseBackoff) * time.Second,
+		MaxBackoff:  time.Duration(retry.MaxBackoff) * time.Second,
+		Deadline:    time.Duration(retry.Deadline) * time.Second,
+		Statuses:    retry.Statuses,
+		Errors:      retry.Errors,
+	}
+
+	if policy.MaxAttempts <= 1 {
+		return policy
+	}
+
+	if interval := MinInterval(cfg); interval > 0 && (policy.Deadline <= 0 || policy.Deadline >= interval) {
+		if policy.Deadline >= interval {
+			log.New("main").Warnw("Retry deadline is not shorter than the cron interval, using half of the interval", "deadline", policy.Deadline.String(), "interval", interval.String())
+		}
+		policy.Deadline = interval / 2
+	}
+
+	return policy
+}
+
+// Sleep waits for d or until ctx is done, it reports whether the full
+// duration elapsed.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// WithGrace returns a context that outlives the shutdown signal by the
+// configured grace period, so an in-flight upload is not cut in half.
+func WithGrace(ctx context.Context, app *config.App) (context.Context, context.CancelFunc) {
+	taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	grace := time.Duration(app.Cfg.Shutdown.GracePeriod) * time.Second
+	stop := context.AfterFunc(ctx, func() {
+		log.New("main").Infow("Shutdown requested, waiting for the running task", "grace_period", grace.String())
+		time.AfterFunc(grace, cancel)
+	})
+
+	return taskCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// RunTask runs Task with a context that outlives the shutdown signal by the
+// configured grace period.
+func RunTask(ctx context.Context, app *config.App, upstream *api.Upstream) (*api.Holavonat, error) {
+	taskCtx, cancel := WithGrace(ctx, app)
+	defer cancel()
+
+	return Task(taskCtx, app, upstream)
+}
+
+// Every runs task every interval until ctx is done, independently of the
+// vehicle positions cron.
+func Every(ctx context.Context, app *config.App, name string, interval time.Duration, task func(context.Context) error) {
+	l := log.New(name)
+	for {
+		l.Infow("Starting scheduled job")
+		taskCtx, cancel := WithGrace(ctx, app)
+		err := task(taskCtx)
+		cancel()
+		if err != nil {
+			l.Errorw("Failed to complete scheduled job", "error", err)
+		} else {
+			l.Infow("Scheduled job completed successfully")
+		}
+
+		l.Infow("Sleeping until next scheduled job", "interval", interval.Seconds(), "date", time.Now().Add(interval).Format(time.RFC3339))
+		if !Sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+func FixCron(ctx context.Context, app *config.App, upstream *api.Upstream) {
+	interval := time.Duration(app.Cfg.Cron.Fix.Interval) * Multiplier(app.Cfg.Cron.Duration)
+
+	for {
+		l := log.New("FixCron")
+		l.Infow("Starting scheduled fetch/upload cycle")
+		_, err := RunTask(ctx, app, upstream)
+		if err != nil {
+			l.Errorw("Failed to complete scheduled task", "error", err)
+		} else {
+			l.Infow("Scheduled task completed successfully")
+			metrics.Succeeded(time.Now())
+		}
+
+		metrics.Interval.Set(interval.Seconds())
+		l.Infow("Sleeping until next scheduled run", "interval", interval.Seconds(), "date", time.Now().Add(interval).Format(time.RFC3339))
+		if !Sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+func WindowCron(ctx context.Context, app *config.App, upstream *api.Upstream) {
+	multiplier := Multiplier(app.Cfg.Cron.Duration)
+
+	min := app.Cfg.Cron.Window.Min
+	max := app.Cfg.Cron.Window.Max
+
+	for {
+		l := log.New("WindowCron")
+		l.Infow("Starting scheduled fetch/upload cycle")
+		_, err := RunTask(ctx, app, upstream)
+		if err != nil {
+			l.Errorw("Failed to complete scheduled task", "error", err)
+		} else {
+			l.Infow("Scheduled task completed successfully")
+			metrics.Succeeded(time.Now())
+		}
+
+		interval := time.Duration(rand.Intn(max-min+1)+min) * multiplier
+
+		metrics.Interval.Set(interval.Seconds())
+		l.Infow("Sleeping until next scheduled run", "interval", interval.Seconds(), "date", time.Now().Add(interval).Format(time.RFC3339))
+		if !Sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+func ScheduleCron(ctx context.Context, app *config.App, upstream *api.Upstream) {
+	s, err := NewSchedule(app.Cfg)
+	if err != nil {
+		log.New("ScheduleCron").Errorw("Failed to parse schedule", "error", err)
+		return
+	}
+
+	for {
+		l := log.New("ScheduleCron")
+		l.Infow("Starting scheduled fetch/upload cycle")
+		_, err := RunTask(ctx, app, upstream)
+		if err != nil {
+			l.Errorw("Failed to complete scheduled task", "error", err)
+		} else {
+			l.Infow("Scheduled task completed successfully")
+			metrics.Succeeded(time.Now())
+		}
+
+		next := s.Next(time.Now())
+		interval := time.Until(next)
+
+		metrics.Interval.Set(interval.Seconds())
+		l.Infow("Sleeping until next scheduled run", "interval", interval.Seconds(), "date", next.In(api.Location).Format(time.RFC3339))
+		if !Sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+func AdaptiveCron(ctx context.Context, app *config.App, upstream *api.Upstream) {
+	multiplier := Multiplier(app.Cfg.Cron.Duration)
+	adaptive := schedule.NewAdaptive(
+		time.Duration(app.Cfg.Cron.Adaptive.Min)*multiplier,
+		time.Duration(app.Cfg.Cron.Adaptive.Max)*multiplier,
+		time.Duration(app.Cfg.Cron.Adaptive.ErrorMax)*multiplier,
+		app.Cfg.Cron.Adaptive.MinChanges,
+	)
+
+	for {
+		l := log.New("AdaptiveCron")
+		l.Infow("Starting scheduled fetch/upload cycle")
+		data, err := RunTask(ctx, app, upstream)
+		if err != nil {
+			l.Errorw("Failed to complete scheduled task", "error", err)
+		} else {
+			l.Infow("Scheduled task completed successfully")
+			metrics.Succeeded(time.Now())
+		}
+
+		// Upload errors do not slow down polling, only a failed fetch does.
+		interval := adaptive.Observe(data, err)
+
+		metrics.Interval.Set(interval.Seconds())
+		l.Infow("Sleeping until next scheduled run", "interval", interval.Seconds(), "date", time.Now().Add(interval).Format(time.RFC3339))
+		if !Sleep(ctx, interval) {
+			return
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package app_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/app"
+	"github.com/holavonat/holavonatis/internal/config"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	cfg := config.Config{
+		Cron: config.Cron{Mode: config.Fix, Fix: config.FixMode{Interval: 30}},
+	}
+
+	// Without retrying the requests are only limited by the client timeout.
+	r.Zero(t, app.NewRetryPolicy(cfg).Deadline)
+
+	cfg.Network.Retry.MaxAttempts = 3
+	r.Equal(t, 15*time.Second, app.NewRetryPolicy(cfg).Deadline)
+
+	cfg.Network.Retry.Deadline = 60
+	r.Equal(t, 15*time.Second, app.NewRetryPolicy(cfg).Deadline)
+
+	cfg.Network.Retry.Deadline = 20
+	r.Equal(t, 20*time.Second, app.NewRetryPolicy(cfg).Deadline)
+}
@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/flat"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/punctuality"
+	"github.com/holavonat/holavonatis/internal/reference"
+)
+
+// NewAlertsTask returns the alerts job. The first and last seen times are
+// restored from the previous output when a sink can read it back.
+func NewAlertsTask(ctx context.Context, app *config.App, upstream *api.Upstream) (func(context.Context) error, error) {
+	cfg := app.Cfg.Alerts
+
+	templates, err := NewTemplates(app.Cfg)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.Template
+	if name == "" {
+		name = api.AlertsTemplate
+	}
+	query, err := templates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := api.AlertFilter{
+		Feeds:         cfg.Feeds,
+		SeverityLevel: cfg.SeverityLevel,
+		Effect:        cfg.Effect,
+		Cause:         cfg.Cause,
+		Route:         cfg.Route,
+		Stop:          cfg.Stop,
+	}
+
+	tracker := api.NewAlertTracker(cfg.Retention)
+	if raw, err := app.Publisher.Load(ctx, cfg.Name+".json"); err == nil {
+		var previous api.AlertsFeed
+		if err := json.Unmarshal(raw, &previous); err == nil {
+			tracker.Seed(previous.Alerts)
+		}
+	} else if !errors.Is(err, output.ErrNotExist) {
+		log.New("Alerts").Warnw("Failed to load previous alerts", "error", err)
+	}
+
+	return func(ctx context.Context) error {
+		feed, err := upstream.FetchAlerts(ctx, query, filter)
+		if err != nil {
+			return err
+		}
+		feed.Alerts = tracker.Track(feed.Alerts, time.Now())
+
+		timestamp := time.Now().Format(time.RFC3339)
+		feed.Source = app.Cfg.Source
+		feed.Source.DirectLink = feed.Source.Latest + cfg.Name + "_" + timestamp + ".json"
+		feed.Source.Latest += cfg.Name + ".json"
+
+		raw, err := json.Marshal(feed)
+		if err != nil {
+			return err
+		}
+
+		// Alerts are archived regardless of Output.Archive, so past
+		// disruptions can be studied.
+		errLatest := app.Publisher.Publish(ctx, output.Object{
+			Name:        cfg.Name + ".json",
+			ContentType: "application/json",
+		}, raw)
+		errArchive := app.Publisher.Publish(ctx, output.Object{
+			Name:        cfg.Name + "_" + timestamp + ".json",
+			ContentType: "application/json",
+			Archive:     true,
+		}, raw)
+
+		return errors.Join(errLatest, errArchive)
+	}, nil
+}
+
+// NewCancellationsTask returns the cancelled trips job, it also updates the
+// trips marked as cancelled in the vehicle snapshots.
+func NewCancellationsTask(app *config.App, upstream *api.Upstream) (func(context.Context) error, error) {
+	cfg := app.Cfg.Cancellations
+
+	templates, err := NewTemplates(app.Cfg)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.Template
+	if name == "" {
+		name = api.CancellationsTemplate
+	}
+	query, err := templates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		now := time.Now()
+		feed, err := upstream.FetchCancellations(ctx, query, api.CancellationFilter{
+			From:     now.Add(-cfg.Lookback),
+			To:       now.Add(cfg.Lookahead),
+			Feeds:    cfg.Feeds,
+			Routes:   cfg.Routes,
+			Language: app.Cfg.Query.Language,
+		})
+		if err != nil {
+			return err
+		}
+		app.Cancellations.Set(feed.Cancellations)
+
+		timestamp := now.Format(time.RFC3339)
+		feed.Source = app.Cfg.Source
+		feed.Source.DirectLink = feed.Source.Latest + cfg.Name + "_" + timestamp + ".json"
+		feed.Source.Latest += cfg.Name + ".json"
+
+		raw, err := json.Marshal(feed)
+		if err != nil {
+			return err
+		}
+
+		return Publish(ctx, app, cfg.Name, ".json", "application/json", timestamp, raw)
+	}, nil
+}
+
+// NewPunctualityTask returns the job publishing the report of every service
+// date in progress, the one of today also as the latest. Dates before
+// yesterday are dropped after their last report. The observations are only
+// kept in memory, so after a restart a stored report counting more stops is
+// kept until the new one catches up.
+func NewPunctualityTask(app *config.App) func(context.Context) error {
+	cfg := app.Cfg.Punctuality
+	table := flat.NewPunctuality()
+	l := log.New("punctuality")
+
+	// counts holds the overall count of the last report of each date.
+	counts := make(map[string]int)
+	stored := func(ctx context.Context, date string) int {
+		count, ok := counts[date]
+		if ok {
+			return count
+		}
+		raw, err := app.Publisher.Load(ctx, cfg.Name+"_"+date+".json")
+		if err == nil {
+			var report punctuality.Report
+			if err = json.Unmarshal(raw, &report); err == nil {
+				count = report.Overall.Count
+			}
+		}
+		if err != nil && !errors.Is(err, output.ErrNotExist) {
+			l.Warnw("Failed to load the stored report", "date", date, "error", err)
+		}
+		counts[date] = count
+		return count
+	}
+
+	return func(ctx context.Context) error {
+		now := time.Now()
+		today := now.In(api.Location).Format(time.DateOnly)
+		yesterday := now.In(api.Location).AddDate(0, 0, -1).Format(time.DateOnly)
+
+		var errs []error
+		for _, date := range app.Punctuality.Dates() {
+			report := app.Punctuality.Report(date, cfg.Worst, now)
+			if count := stored(ctx, date); report.Overall.Count < count {
+				l.Debugw("Keeping the stored report until the observations catch up", "date", date, "stored", count, "observed", report.Overall.Count)
+				continue
+			}
+			counts[date] = report.Overall.Count
+
+			raw, err := json.Marshal(report)
+			if err != nil {
+				return err
+			}
+			csv, err := table.CSV(report.Stats())
+			if err != nil {
+				return err
+			}
+			csv = append(table.CSVHeader(), csv...)
+
+			names := []string{cfg.Name + "_" + date}
+			if date == today {
+				names = append(names, cfg.Name)
+			}
+			for _, name := range names {
+				errs = append(errs,
+					app.Publisher.Publish(ctx, output.Object{Name: name + ".json", ContentType: "application/json"}, raw),
+					app.Publisher.Publish(ctx, output.Object{Name: name + ".csv", ContentType: flat.ContentTypeCSV}, csv),
+				)
+			}
+		}
+		app.Punctuality.Expire(yesterday)
+		for date := range counts {
+			if date < yesterday {
+				delete(counts, date)
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+}
+
+// NewReferenceTask returns the reference export job.
+func NewReferenceTask(app *config.App, upstream *api.Upstream) (func(context.Context) error, error) {
+	templates, err := NewTemplates(app.Cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := &reference.Exporter{
+		Publisher: &app.Publisher,
+		Path:      app.Cfg.Reference.Path,
+		Keep:      app.Cfg.Reference.Keep,
+	}
+
+	return func(ctx context.Context) error {
+		data, err := upstream.FetchReference(ctx, templates, app.Cfg.Query.Language)
+		if err != nil {
+			return err
+		}
+
+		_, err = exporter.Export(ctx, data, time.Now())
+		return err
+	}, nil
+}
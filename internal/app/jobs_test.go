@@ -0,0 +1,59 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/app"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/punctuality"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestPunctualityTask(t *testing.T) {
+	now := time.Now()
+	serviceDay := api.ServiceDayStart(now).Unix()
+	date := api.ServiceDayStart(now).Format(time.DateOnly)
+	passed := now.Unix() - serviceDay - 60
+
+	observed := func(dir string) *config.App {
+		fs, err := output.NewFilesystem(dir)
+		r.NoError(t, err)
+		a := &config.App{
+			Cfg:         config.Config{Punctuality: config.Punctuality{Name: "punctuality", Worst: 1}},
+			Publisher:   output.Publisher{Destinations: []output.Destination{{Name: "local", Sink: fs}}},
+			Punctuality: punctuality.NewAggregator(),
+		}
+		a.Punctuality.Observe(api.Holavonat{VehiclePositions: []api.VehiclePositions{{
+			VehicleID:   "v1",
+			LastUpdated: int(now.Unix()),
+			Trip: api.Trip{GtfsID: "1:t1", Stoptimes: []api.Stoptimes{
+				{ServiceDay: serviceDay, RealtimeDeparture: passed},
+			}},
+		}}})
+		return a
+	}
+	count := func(dir string) int {
+		raw, err := os.ReadFile(filepath.Join(dir, "punctuality_"+date+".json"))
+		r.NoError(t, err)
+		var report punctuality.Report
+		r.NoError(t, json.Unmarshal(raw, &report))
+		return report.Overall.Count
+	}
+
+	dir := t.TempDir()
+	r.NoError(t, app.NewPunctualityTask(observed(dir))(context.Background()))
+	r.Equal(t, 1, count(dir))
+
+	// After a restart the stored report counting more stops is kept.
+	dir = t.TempDir()
+	r.NoError(t, os.WriteFile(filepath.Join(dir, "punctuality_"+date+".json"), []byte(`{"overall":{"count":5}}`), 0o644))
+	r.NoError(t, app.NewPunctualityTask(observed(dir))(context.Background()))
+	r.Equal(t, 5, count(dir))
+}
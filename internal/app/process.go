@@ -0,0 +1,330 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/delta"
+	"github.com/holavonat/holavonatis/internal/events"
+	"github.com/holavonat/holavonatis/internal/flat"
+	"github.com/holavonat/holavonatis/internal/geojson"
+	"github.com/holavonat/holavonatis/internal/gtfsrt"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/metrics"
+	"github.com/holavonat/holavonatis/internal/output"
+)
+
+// Task fetches, transforms and publishes one snapshot. The snapshot is nil
+// when the fetch failed, publishing errors are returned next to it.
+func Task(ctx context.Context, app *config.App, upstream *api.Upstream) (*api.Holavonat, error) {
+	data, err := upstream.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.Cancellations != nil {
+		app.Cancellations.Mark(&data)
+	}
+
+	return &data, Process(ctx, app, &data, time.Now().Format(time.RFC3339))
+}
+
+// Process transforms and publishes one snapshot taken at timestamp to every
+// output format and the stream.
+func Process(ctx context.Context, app *config.App, data *api.Holavonat, timestamp string) error {
+	vehicles := make(map[string]int)
+	for _, vehicle := range data.VehiclePositions {
+		vehicles[vehicle.Trip.Route.Mode]++
+	}
+	metrics.ObserveVehicles(vehicles)
+
+	archiveName := app.Cfg.Output.NamePrefix + "_" + timestamp + ".json"
+
+	data.Source = app.Cfg.Source
+	data.Source.DirectLink = data.Source.Latest + archiveName
+	data.Source.Latest += app.Cfg.Output.NamePrefix + ".json"
+
+	var patch *delta.Delta
+	if app.Delta != nil {
+		var err error
+		if data.Sequence, patch, err = app.Delta.Next(*data); err != nil {
+			return err
+		}
+	}
+
+	if app.Hub != nil {
+		app.Hub.Publish(*data)
+	}
+
+	raw, err := data.Json()
+	if err != nil {
+		return err
+	}
+
+	errs := []error{
+		Publish(ctx, app, app.Cfg.Output.NamePrefix, ".json", "application/json", timestamp, raw),
+	}
+
+	if app.Delta != nil {
+		errs = append(errs, app.Delta.Publish(ctx, data.Sequence, patch))
+	}
+
+	if app.Cfg.Output.Format.GTFSRT {
+		feeds, err := gtfsrt.Encode(*data)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			errs = append(errs,
+				Publish(ctx, app, app.Cfg.Output.NamePrefix+"_vehicle_positions", ".pb", gtfsrt.ContentType, timestamp, feeds.VehiclePositions),
+				Publish(ctx, app, app.Cfg.Output.NamePrefix+"_trip_updates", ".pb", gtfsrt.ContentType, timestamp, feeds.TripUpdates),
+				Publish(ctx, app, app.Cfg.Output.NamePrefix+"_alerts", ".pb", gtfsrt.ContentType, timestamp, feeds.Alerts),
+			)
+		}
+	}
+
+	if app.Cfg.Output.Format.GeoJSON {
+		raw, err := geojson.Encode(*data)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			errs = append(errs, Publish(ctx, app, app.Cfg.Output.NamePrefix, ".geojson", geojson.ContentType, timestamp, raw))
+		}
+	}
+
+	if app.Columnar != nil {
+		errs = append(errs, app.Columnar.Write(ctx, *data))
+	}
+
+	if app.History != nil {
+		errs = append(errs, app.History.Write(ctx, *data))
+	}
+
+	if app.Positions != nil {
+		errs = append(errs, PublishFlat(ctx, app, *data, timestamp))
+	}
+
+	if app.Punctuality != nil {
+		app.Punctuality.Observe(*data)
+	}
+
+	if app.Events != nil {
+		errs = append(errs, PublishEvents(ctx, app, app.Events.Observe(*data)))
+	}
+
+	if app.Normalized != nil {
+		errs = append(errs, PublishV4(ctx, app, *data, timestamp))
+	}
+
+	return errors.Join(errs...)
+}
+
+// PublishFlat writes the vehicles as flat CSV and NDJSON rows and appends
+// them to the file of the service day when Daily is enabled.
+func PublishFlat(ctx context.Context, app *config.App, data api.Holavonat, timestamp string) error {
+	cfg := app.Cfg.Output
+	rows := columnar.Positions(data)
+	day := time.Unix(data.LastUpdated, 0).In(api.Location).Format(time.DateOnly)
+
+	var errs []error
+	if cfg.Format.CSV {
+		raw, err := app.Positions.CSV(rows)
+		if err != nil {
+			return err
+		}
+		header := app.Positions.CSVHeader()
+		errs = append(errs, Publish(ctx, app, cfg.NamePrefix, ".csv", flat.ContentTypeCSV, timestamp, append(append([]byte{}, header...), raw...)))
+		if cfg.Flat.Daily {
+			errs = append(errs, app.Publisher.Append(ctx, output.Object{
+				Name:        cfg.NamePrefix + "_positions_" + day + ".csv",
+				ContentType: flat.ContentTypeCSV,
+			}, header, raw))
+		}
+	}
+
+	if cfg.Format.NDJSON {
+		raw, err := app.Positions.NDJSON(rows)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, Publish(ctx, app, cfg.NamePrefix, ".ndjson", flat.ContentTypeNDJSON, timestamp, raw))
+		if cfg.Flat.Daily {
+			errs = append(errs, app.Publisher.Append(ctx, output.Object{
+				Name:        cfg.NamePrefix + "_positions_" + day + ".ndjson",
+				ContentType: flat.ContentTypeNDJSON,
+			}, nil, raw))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PublishEvents appends the events to the files of their service dates.
+func PublishEvents(ctx context.Context, app *config.App, observed []events.Event) error {
+	cfg := app.Cfg.Events
+	table := flat.NewEvents()
+
+	days := make(map[string][]events.Event)
+	for _, event := range observed {
+		days[event.ServiceDate] = append(days[event.ServiceDate], event)
+	}
+
+	var errs []error
+	for day, list := range days {
+		raw, err := table.NDJSON(list)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, app.Publisher.Append(ctx, output.Object{
+			Name:        cfg.Name + "_" + day + ".ndjson",
+			ContentType: flat.ContentTypeNDJSON,
+		}, nil, raw))
+
+		if cfg.CSV {
+			raw, err := table.CSV(list)
+			if err != nil {
+				return err
+			}
+			errs = append(errs, app.Publisher.Append(ctx, output.Object{
+				Name:        cfg.Name + "_" + day + ".csv",
+				ContentType: flat.ContentTypeCSV,
+			}, table.CSVHeader(), raw))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PublishV4 writes the dictionaries that changed, then the normalized
+// snapshot referring to them.
+func PublishV4(ctx context.Context, app *config.App, data api.Holavonat, timestamp string) error {
+	cfg := app.Cfg.Output.V4
+	snapshot, dictionaries := app.Normalized.Encode(data)
+
+	snapshot.Source = app.Cfg.Source
+	snapshot.Source.DirectLink = snapshot.Source.Latest + cfg.NamePrefix + "_" + timestamp + ".json"
+	snapshot.Source.Latest += cfg.NamePrefix + ".json"
+
+	if dictionaries != nil {
+		var errs []error
+		if dictionaries.Stops != nil {
+			raw, err := json.Marshal(dictionaries.Stops)
+			if err == nil {
+				err = PublishDictionary(ctx, app, cfg.NamePrefix+"_stops", dictionaries.Versions.Stops, raw)
+			}
+			errs = append(errs, err)
+		}
+		if dictionaries.Geometries != nil {
+			raw, err := json.Marshal(dictionaries.Geometries)
+			if err == nil {
+				err = PublishDictionary(ctx, app, cfg.NamePrefix+"_geometries", dictionaries.Versions.Geometries, raw)
+			}
+			errs = append(errs, err)
+		}
+		if err := errors.Join(errs...); err != nil {
+			app.Normalized.Reset()
+			return err
+		}
+
+		if cfg.Inline {
+			snapshot.Stops = dictionaries.Stops
+			snapshot.Geometries = dictionaries.Geometries
+		}
+	}
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return Publish(ctx, app, cfg.NamePrefix, ".json", "application/json", timestamp, raw)
+}
+
+// DictionaryVersions is stored as {name}_versions.json next to a v4
+// dictionary, so the versions replaced before the previous one can be deleted,
+// also after a restart.
+type DictionaryVersions struct {
+	Current  string `json:"current"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// PublishDictionary writes a v4 dictionary under its name and under its
+// version, which is a content hash, so the latter can be cached for good. The
+// previous version is kept for the clients still holding an older snapshot,
+// the ones before it are deleted. The versions are not kept by the server
+// memory, which serves the latest dictionary only.
+func PublishDictionary(ctx context.Context, app *config.App, name, version string, raw []byte) error {
+	versionsName := name + "_versions.json"
+
+	var versions DictionaryVersions
+	if stored, err := app.Publisher.Load(ctx, versionsName); err == nil {
+		if err := json.Unmarshal(stored, &versions); err != nil {
+			log.New("v4").Warnw("Failed to parse dictionary versions", "name", versionsName, "error", err)
+		}
+	} else if !errors.Is(err, output.ErrNotExist) {
+		log.New("v4").Warnw("Failed to load dictionary versions", "name", versionsName, "error", err)
+	}
+
+	if err := app.Publisher.Publish(ctx, output.Object{
+		Name:         name + "_" + version + ".json",
+		ContentType:  "application/json",
+		CacheControl: output.Immutable,
+		Archive:      true,
+	}, raw); err != nil {
+		return err
+	}
+	if err := app.Publisher.Publish(ctx, output.Object{
+		Name:        name + ".json",
+		ContentType: "application/json",
+	}, raw); err != nil {
+		return err
+	}
+
+	if versions.Current == version {
+		return nil
+	}
+	replaced := versions.Previous
+	versions = DictionaryVersions{Current: version, Previous: versions.Current}
+
+	stored, err := json.Marshal(versions)
+	if err != nil {
+		return err
+	}
+	if err := app.Publisher.Publish(ctx, output.Object{
+		Name:         versionsName,
+		ContentType:  "application/json",
+		CacheControl: "no-cache",
+		Archive:      true,
+	}, stored); err != nil {
+		return err
+	}
+
+	if replaced != "" && replaced != versions.Current && replaced != versions.Previous {
+		return app.Publisher.Delete(ctx, name+"_"+replaced+".json")
+	}
+	return nil
+}
+
+// Publish writes {name}{ext} to every sink and, when archiving is enabled,
+// {name}_{timestamp}{ext} as well.
+func Publish(ctx context.Context, app *config.App, name, ext, contentType, timestamp string, raw []byte) error {
+	errLatest := app.Publisher.Publish(ctx, output.Object{
+		Name:        name + ext,
+		ContentType: contentType,
+	}, raw)
+
+	var errArchive error
+	if app.Cfg.Output.Archive {
+		errArchive = app.Publisher.Publish(ctx, output.Object{
+			Name:        name + "_" + timestamp + ext,
+			ContentType: contentType,
+			Archive:     true,
+		}, raw)
+	}
+
+	return errors.Join(errLatest, errArchive)
+}
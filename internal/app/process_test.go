@@ -0,0 +1,47 @@
+package app_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/app"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/server"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestPublishDictionary(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs, err := output.NewFilesystem(dir)
+	r.NoError(t, err)
+	memory := server.NewMemory()
+
+	a := &config.App{Publisher: output.Publisher{Destinations: []output.Destination{
+		{Name: "local", Sink: fs},
+		{Name: "server", Sink: memory},
+	}}}
+
+	for _, version := range []string{"a1", "a1", "b2", "c3"} {
+		r.NoError(t, app.PublishDictionary(ctx, a, "v4_stops", version, []byte(`{"version":"`+version+`"}`)))
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "v4_stops_a1.json"))
+	r.ErrorIs(t, err, os.ErrNotExist)
+	for _, name := range []string{"v4_stops.json", "v4_stops_b2.json", "v4_stops_c3.json"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		r.NoError(t, err, name)
+	}
+
+	raw, err := a.Publisher.Load(ctx, "v4_stops_versions.json")
+	r.NoError(t, err)
+	r.JSONEq(t, `{"current":"c3","previous":"b2"}`, string(raw))
+
+	objects, err := memory.List(ctx, "")
+	r.NoError(t, err)
+	r.Len(t, objects, 1)
+	r.Equal(t, "v4_stops.json", objects[0].Name)
+}
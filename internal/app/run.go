@@ -0,0 +1,473 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/cloudflare"
+	"github.com/holavonat/holavonatis/internal/cloudflare/r2"
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/config"
+	"github.com/holavonat/holavonatis/internal/delta"
+	"github.com/holavonat/holavonatis/internal/events"
+	"github.com/holavonat/holavonatis/internal/flat"
+	"github.com/holavonat/holavonatis/internal/history"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/metrics"
+	"github.com/holavonat/holavonatis/internal/normalized"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/punctuality"
+	"github.com/holavonat/holavonatis/internal/server"
+	"github.com/holavonat/holavonatis/internal/stream"
+)
+
+// Run fetches and publishes snapshots on the configured schedule and runs
+// the periodic jobs until ctx is done.
+func Run(ctx context.Context, cfg config.Config, assets fs.FS) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	l := log.New("main")
+
+	upstream, err := NewUpstream(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Cron.Mode == config.Schedule {
+		if _, err := NewSchedule(cfg); err != nil {
+			return fmt.Errorf("failed to parse schedule: %w", err)
+		}
+	}
+
+	trace, err := cloudflare.GetTrace(&http.Client{})
+	if err != nil {
+		return fmt.Errorf("failed to get trace: %w", err)
+	}
+
+	l.Infow("Public IP address", "ip", trace.Ip, "location", trace.Location, "colo", trace.Colocation)
+
+	if cfg.Network.Proxy != "" {
+		proxyTrace, err := cloudflare.GetTraceProxy(&http.Client{}, cfg.Network.Proxy)
+		if err != nil {
+			return fmt.Errorf("failed to get trace with proxy: %w", err)
+		}
+		if proxyTrace.Ip == trace.Ip {
+			l.Warnw("Proxy IP matches public IP, this may not be a valid proxy", "proxy", cfg.Network.Proxy, "public_ip", trace.Ip)
+		}
+
+		l.Infow("Using proxy for API requests", "proxy", cfg.Network.Proxy, "public_ip", trace.Ip)
+	}
+
+	app := config.App{
+		Cfg:    cfg,
+		Assets: assets,
+	}
+
+	if cfg.Events.Enabled {
+		app.Events = events.NewTracker(cfg.Events.Retention, cfg.Events.VanishAfter)
+	}
+
+	if err := NewSinks(&app); err != nil {
+		return err
+	}
+
+	if err := NewFormats(ctx, &app); err != nil {
+		return err
+	}
+
+	if cfg.History.Path != "" {
+		app.History, err = history.Open(cfg.History.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open history store %s: %w", cfg.History.Path, err)
+		}
+		defer app.History.Close()
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		stop()
+		wg.Wait()
+	}()
+
+	if cfg.Server.Listen != "" {
+		srv, err := NewServer(&app)
+		if err != nil {
+			return fmt.Errorf("failed to create HTTP server: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Infow("Starting HTTP server", "listen", cfg.Server.Listen, "static", cfg.Server.Static)
+			if err := srv.ListenAndServe(ctx, cfg.Server.Listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.Errorw("HTTP server stopped", "error", err)
+			}
+		}()
+	}
+
+	if cfg.Metrics.Listen != "" {
+		maxAge := time.Duration(cfg.Metrics.StaleIntervals) * MaxInterval(cfg)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Infow("Starting metrics server", "listen", cfg.Metrics.Listen, "stale_after", maxAge.String())
+			if err := metrics.ListenAndServe(ctx, cfg.Metrics.Listen, maxAge); err != nil {
+				l.Errorw("Metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	if cfg.Alerts.Interval > 0 {
+		task, err := NewAlertsTask(ctx, &app, upstream)
+		if err != nil {
+			return fmt.Errorf("failed to create alerts job: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Every(ctx, &app, "Alerts", cfg.Alerts.Interval, task)
+		}()
+	}
+
+	if cfg.Cancellations.Interval > 0 {
+		app.Cancellations = &api.Cancellations{}
+		task, err := NewCancellationsTask(&app, upstream)
+		if err != nil {
+			return fmt.Errorf("failed to create cancellations job: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Every(ctx, &app, "Cancellations", cfg.Cancellations.Interval, task)
+		}()
+	}
+
+	if cfg.Punctuality.Interval > 0 {
+		app.Punctuality = punctuality.NewAggregator()
+		task := NewPunctualityTask(&app)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Every(ctx, &app, "Punctuality", cfg.Punctuality.Interval, task)
+		}()
+	}
+
+	if app.History != nil {
+		task := func(ctx context.Context) error {
+			return app.History.Prune(ctx, time.Now().Add(-cfg.History.Retention))
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Every(ctx, &app, "History", time.Hour, task)
+		}()
+	}
+
+	if cfg.Reference.Interval > 0 {
+		task, err := NewReferenceTask(&app, upstream)
+		if err != nil {
+			return fmt.Errorf("failed to create reference job: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Every(ctx, &app, "Reference", cfg.Reference.Interval, task)
+		}()
+	}
+
+	switch cfg.Cron.Mode {
+	case "fix":
+		l.Infow("Starting fix cron job")
+		FixCron(ctx, &app, upstream)
+	case "window":
+		l.Infow("Starting window cron job")
+		WindowCron(ctx, &app, upstream)
+	case "schedule":
+		l.Infow("Starting schedule cron job")
+		ScheduleCron(ctx, &app, upstream)
+	case "adaptive":
+		l.Infow("Starting adaptive cron job")
+		AdaptiveCron(ctx, &app, upstream)
+	}
+
+	if err := Flush(ctx, &app); err != nil {
+		l.Errorw("Failed to flush the Parquet archive", "error", err)
+	}
+
+	l.Infow("Shutting down")
+	return nil
+}
+
+// Once fetches and publishes a single snapshot. The server, the periodic
+// jobs and the outputs following the vehicles across cycles (events and
+// punctuality) are left out, and so is the Parquet archive, which would get
+// a part with one snapshot on every run.
+func Once(ctx context.Context, cfg config.Config) error {
+	upstream, err := NewUpstream(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Output.Format.Parquet {
+		log.New("main").Infow("Skipping the Parquet archive for a single snapshot")
+		cfg.Output.Format.Parquet = false
+	}
+
+	app := config.App{
+		Cfg: cfg,
+	}
+
+	if err := NewSinks(&app); err != nil {
+		return err
+	}
+
+	if err := NewFormats(ctx, &app); err != nil {
+		return err
+	}
+
+	if cfg.History.Path != "" {
+		app.History, err = history.Open(cfg.History.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open history store %s: %w", cfg.History.Path, err)
+		}
+		defer app.History.Close()
+	}
+
+	data, err := RunTask(ctx, &app, upstream)
+	if data != nil {
+		log.New("main").Infow("Fetched snapshot", "vehicles", len(data.VehiclePositions))
+	}
+	return errors.Join(err, Flush(ctx, &app))
+}
+
+// Flush publishes the open hour of the Parquet archive, it gets the grace
+// period even after ctx is done.
+func Flush(ctx context.Context, app *config.App) error {
+	if app.Columnar == nil {
+		return nil
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(app.Cfg.Shutdown.GracePeriod)*time.Second)
+	defer cancel()
+	return app.Columnar.Flush(flushCtx)
+}
+
+// NewUpstream builds the API client and the vehicle positions query.
+func NewUpstream(cfg config.Config) (*api.Upstream, error) {
+	l := log.New("main")
+
+	query, params, err := NewQuery(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load query template: %w", err)
+	}
+
+	// The client adds its own headers, so the config is not shared.
+	headers := maps.Clone(cfg.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+
+	var client *api.Client
+
+	timeout := 60 * time.Second
+	if cfg.Network.Timeout > 0 {
+		timeout = time.Duration(cfg.Network.Timeout) * time.Second
+	}
+
+	if cfg.Network.Proxy != "" {
+		client, err = api.NewClientProxy(cfg.GraphqlEndpoint, headers, &http.Client{
+			Timeout: timeout,
+		}, cfg.Network.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client with proxy: %w", err)
+		}
+	} else {
+		client, err = api.NewClientCustomHTTP(cfg.GraphqlEndpoint, headers, &http.Client{
+			Timeout: timeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create custom HTTP client: %w", err)
+		}
+	}
+
+	client.Observer = metrics.Recorder{}
+	client.Retry = NewRetryPolicy(cfg)
+	client.AllowPartial = cfg.Network.PartialData == config.Publish
+	if client.Retry.MaxAttempts > 1 {
+		l.Infow("Retrying failed requests", "max_attempts", client.Retry.MaxAttempts, "deadline", client.Retry.Deadline.String())
+	}
+
+	return &api.Upstream{
+		Client:  client,
+		Query:   query,
+		Params:  params,
+		Tiles:   cfg.Query.Tiles,
+		Workers: cfg.Query.Workers,
+	}, nil
+}
+
+// NewSinks adds a destination for every configured sink to the publisher.
+func NewSinks(app *config.App) error {
+	app.Publisher.Observer = metrics.Recorder{}
+	for _, sink := range app.Cfg.Sinks {
+		destination, err := NewDestination(sink)
+		if err != nil {
+			return fmt.Errorf("failed to create sink %s: %w", sink.Name, err)
+		}
+		app.Publisher.Destinations = append(app.Publisher.Destinations, destination)
+		log.New("main").Infow("Using sink for output", "sink", sink.Name, "type", sink.Type)
+	}
+	return nil
+}
+
+// NewFormats sets up the stateful output formats of app, the sinks must be
+// configured already.
+func NewFormats(ctx context.Context, app *config.App) error {
+	cfg := app.Cfg.Output
+
+	if cfg.Format.V4 {
+		app.Normalized = &normalized.Encoder{}
+	}
+
+	if cfg.Format.NDJSON || cfg.Format.CSV {
+		positions, err := flat.NewPositions(cfg.Flat.Columns)
+		if err != nil {
+			return fmt.Errorf("invalid flat output columns: %w", err)
+		}
+		app.Positions = positions
+	}
+
+	if cfg.Format.Parquet {
+		app.Columnar = &columnar.Writer{
+			Publisher: &app.Publisher,
+			Path:      cfg.Parquet.Path,
+			Dir:       cfg.Parquet.Dir,
+		}
+	}
+
+	if cfg.Format.Delta {
+		app.Delta = &delta.Feed{
+			Publisher: &app.Publisher,
+			Name:      cfg.NamePrefix + "_delta",
+			Full:      cfg.NamePrefix + ".json",
+			Keep:      cfg.Delta.Keep,
+		}
+		if err := app.Delta.Restore(ctx); err != nil {
+			log.New("main").Warnw("Failed to restore the delta sequence", "error", err)
+		}
+	}
+
+	return nil
+}
+
+func NewDestination(sink config.Sink) (output.Destination, error) {
+	destination := output.Destination{
+		Name:        sink.Name,
+		Compression: string(sink.Compression),
+	}
+
+	switch sink.Type {
+	case config.R2:
+		s3, err := r2.NewClient(r2.Cloudflare{
+			AccessKeyID:       sink.ObjectStorage.AccessKeyID,
+			SecretAccessKey:   sink.ObjectStorage.SecretAccessKey,
+			BucketName:        sink.ObjectStorage.BucketName,
+			ObjectPath:        sink.ObjectStorage.ObjectPath,
+			EndpointURL:       sink.ObjectStorage.EndpointURL,
+			PublicEndpointURL: sink.ObjectStorage.PublicEndpointURL,
+		})
+		if err != nil {
+			return output.Destination{}, err
+		}
+		destination.Sink = &s3
+
+	case config.FS:
+		fs, err := output.NewFilesystem(sink.File.Path)
+		if err != nil {
+			return output.Destination{}, err
+		}
+		destination.Sink = fs
+
+	default:
+		return output.Destination{}, config.ErrInvalidSinkType
+	}
+
+	return destination, nil
+}
+
+// NewServer registers an in-memory sink for the latest objects and builds
+// the HTTP server around it.
+func NewServer(app *config.App) (*server.Server, error) {
+	cfg := app.Cfg.Server
+
+	memory := server.NewMemory()
+	app.Publisher.Destinations = append(app.Publisher.Destinations, output.Destination{
+		Name: "server",
+		Sink: memory,
+	})
+
+	var static fs.FS
+	switch cfg.Static {
+	case "":
+	case "static", "emig-static":
+		sub, err := fs.Sub(app.Assets, cfg.Static)
+		if err != nil {
+			return nil, err
+		}
+		static = sub
+	default:
+		static = os.DirFS(cfg.Static)
+	}
+
+	var archive output.Sink
+	if cfg.Archive != "" {
+		for _, destination := range app.Publisher.Destinations {
+			if destination.Name == cfg.Archive {
+				archive = destination.Sink
+			}
+		}
+		if archive == nil {
+			return nil, fmt.Errorf("unknown archive sink: %s", cfg.Archive)
+		}
+	}
+
+	srv, err := server.New(server.Server{
+		Memory:        memory,
+		Static:        static,
+		Archive:       archive,
+		ArchivePrefix: app.Cfg.Output.NamePrefix + "_",
+		DataURL:       cfg.DataURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Stream {
+		app.Hub = stream.NewHub(0)
+		srv.Mux.HandleFunc("GET /stream/sse", app.Hub.ServeSSE)
+		srv.Mux.HandleFunc("GET /stream/ws", app.Hub.ServeWebSocket)
+	}
+
+	if app.History != nil {
+		srv.Mux.HandleFunc("GET /api/history/trips/{number}", app.History.ServeTrips)
+		srv.Mux.HandleFunc("GET /api/history/stations/{stop}", app.History.ServeStation)
+		srv.Mux.HandleFunc("GET /api/history/vehicles/{vehicle}/trail", app.History.ServeTrail)
+	}
+
+	return srv, nil
+}
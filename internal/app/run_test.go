@@ -0,0 +1,59 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/app"
+	"github.com/holavonat/holavonatis/internal/config"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"data":{"vehiclePositions":[{"vehicleId":"v1","lat":47.5,"lon":19.04,"trip":{"gtfsId":"1:t1","tripNumber":"2612"}}]}}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := config.Config{
+		GraphqlEndpoint: srv.URL,
+		Cron:            config.Cron{Mode: config.Fix},
+		Sinks:           []config.Sink{{Name: "local", Type: config.FS, File: config.File{Path: dir}}},
+		Output: config.Output{
+			NamePrefix: "data",
+			Format:     config.Format{GeoJSON: true, Parquet: true},
+			Parquet:    config.Parquet{Path: "parquet"},
+		},
+	}
+	r.NoError(t, app.Once(context.Background(), cfg))
+
+	raw, err := os.ReadFile(filepath.Join(dir, "data.json"))
+	r.NoError(t, err)
+	var data api.Holavonat
+	r.NoError(t, json.Unmarshal(raw, &data))
+	r.Len(t, data.VehiclePositions, 1)
+	r.Equal(t, "2612", data.VehiclePositions[0].Trip.TripNumber)
+
+	_, err = os.Stat(filepath.Join(dir, "data.geojson"))
+	r.NoError(t, err)
+
+	// A single snapshot does not start a Parquet part.
+	r.NoError(t, filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		r.False(t, strings.HasSuffix(path, ".parquet"), path)
+		return err
+	}))
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	r.Error(t, app.Once(context.Background(), cfg))
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/holavonat/holavonatis/internal/output"
 )
 
 type Cloudflare struct {
@@ -66,19 +69,14 @@ type UploadedFile struct {
 	PublicLink string `json:"public_link"`
 }
 
-func (c *Cloudflare) UploadFile(filename string, file []byte, contentType string, contentEncoding string) (UploadedFile, error) {
+func (c *Cloudflare) UploadFile(ctx context.Context, filename string, file []byte, contentType string, contentEncoding string) (UploadedFile, error) {
 	if c.Client == nil {
 		return UploadedFile{}, errors.New("client not initialized")
 	}
 
-	var objectPath string
-	if c.ObjectPath == "" {
-		objectPath = filename
-	} else {
-		objectPath = strings.TrimSuffix(c.ObjectPath, "/") + "/" + filename
-	}
+	objectPath := c.key(filename)
 
-	output, err := c.Client.PutObject(context.TODO(), &s3.PutObjectInput{
+	output, err := c.Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:          aws.String(c.BucketName),
 		Key:             aws.String(objectPath),
 		Body:            bytes.NewReader(file),
@@ -96,3 +94,162 @@ func (c *Cloudflare) UploadFile(filename string, file []byte, contentType string
 		PublicLink: c.PublicEndpointURL + "/" + objectPath,
 	}, nil
 }
+
+func (c *Cloudflare) key(name string) string {
+	if c.ObjectPath == "" {
+		return name
+	}
+	return strings.TrimSuffix(c.ObjectPath, "/") + "/" + name
+}
+
+func (c *Cloudflare) name(key string) string {
+	if c.ObjectPath == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, strings.TrimSuffix(c.ObjectPath, "/")+"/")
+}
+
+func (c *Cloudflare) Put(ctx context.Context, object output.Object, data []byte) (output.ObjectInfo, error) {
+	if c.Client == nil {
+		return output.ObjectInfo{}, errors.New("client not initialized")
+	}
+
+	objectPath := c.key(object.Name)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(c.BucketName),
+		Key:         aws.String(objectPath),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(object.ContentType),
+		Metadata:    object.Metadata,
+	}
+	if object.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(object.ContentEncoding)
+	}
+	if object.CacheControl != "" {
+		input.CacheControl = aws.String(object.CacheControl)
+	}
+
+	out, err := c.Client.PutObject(ctx, input)
+	if err != nil {
+		return output.ObjectInfo{}, err
+	}
+
+	return output.ObjectInfo{
+		Name:            object.Name,
+		Size:            int64(len(data)),
+		ETag:            aws.ToString(out.ETag),
+		ContentType:     object.ContentType,
+		ContentEncoding: object.ContentEncoding,
+		CacheControl:    object.CacheControl,
+		Metadata:        object.Metadata,
+		PublicLink:      c.PublicEndpointURL + "/" + objectPath,
+	}, nil
+}
+
+func (c *Cloudflare) Stat(ctx context.Context, name string) (output.ObjectInfo, error) {
+	if c.Client == nil {
+		return output.ObjectInfo{}, errors.New("client not initialized")
+	}
+
+	objectPath := c.key(name)
+	out, err := c.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.BucketName),
+		Key:    aws.String(objectPath),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return output.ObjectInfo{}, output.ErrNotExist
+		}
+		return output.ObjectInfo{}, err
+	}
+
+	return output.ObjectInfo{
+		Name:            name,
+		Size:            aws.ToInt64(out.ContentLength),
+		ETag:            aws.ToString(out.ETag),
+		ContentType:     aws.ToString(out.ContentType),
+		ContentEncoding: aws.ToString(out.ContentEncoding),
+		Metadata:        out.Metadata,
+		LastModified:    aws.ToTime(out.LastModified),
+		PublicLink:      c.PublicEndpointURL + "/" + objectPath,
+	}, nil
+}
+
+func (c *Cloudflare) Get(ctx context.Context, name string) ([]byte, output.ObjectInfo, error) {
+	if c.Client == nil {
+		return nil, output.ObjectInfo{}, errors.New("client not initialized")
+	}
+
+	objectPath := c.key(name)
+	out, err := c.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.BucketName),
+		Key:    aws.String(objectPath),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, output.ObjectInfo{}, output.ErrNotExist
+		}
+		return nil, output.ObjectInfo{}, err
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, output.ObjectInfo{}, err
+	}
+
+	return data, output.ObjectInfo{
+		Name:            name,
+		Size:            int64(len(data)),
+		ETag:            aws.ToString(out.ETag),
+		ContentType:     aws.ToString(out.ContentType),
+		ContentEncoding: aws.ToString(out.ContentEncoding),
+		Metadata:        out.Metadata,
+		LastModified:    aws.ToTime(out.LastModified),
+		PublicLink:      c.PublicEndpointURL + "/" + objectPath,
+	}, nil
+}
+
+func (c *Cloudflare) List(ctx context.Context, prefix string) ([]output.ObjectInfo, error) {
+	if c.Client == nil {
+		return nil, errors.New("client not initialized")
+	}
+
+	var objects []output.ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(c.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.BucketName),
+		Prefix: aws.String(c.key(prefix)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			objectPath := aws.ToString(object.Key)
+			objects = append(objects, output.ObjectInfo{
+				Name:         c.name(objectPath),
+				Size:         aws.ToInt64(object.Size),
+				ETag:         aws.ToString(object.ETag),
+				LastModified: aws.ToTime(object.LastModified),
+				PublicLink:   c.PublicEndpointURL + "/" + objectPath,
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (c *Cloudflare) Delete(ctx context.Context, name string) error {
+	if c.Client == nil {
+		return errors.New("client not initialized")
+	}
+
+	_, err := c.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.BucketName),
+		Key:    aws.String(c.key(name)),
+	})
+	return err
+}
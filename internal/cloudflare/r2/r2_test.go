@@ -1,6 +1,7 @@
 package r2_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -31,7 +32,7 @@ func TestUploadFile(t *testing.T) {
 	file, err := os.ReadFile("test.jpg")
 	r.NoError(t, err)
 
-	uploadedUrl, err := cloudflare.UploadFile("test.jog", file, "image/jpeg", "")
+	uploadedUrl, err := cloudflare.UploadFile(context.Background(), "test.jog", file, "image/jpeg", "")
 	r.NoError(t, err)
 	t.Log("Uploaded url:", uploadedUrl)
 
@@ -0,0 +1,130 @@
+package columnar
+
+import (
+	"slices"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+// PositionRow is one vehicle in one snapshot.
+type PositionRow struct {
+	SnapshotTime  time.Time `parquet:"snapshot_time,timestamp(millisecond)"`
+	VehicleID     string    `parquet:"vehicle_id,dict"`
+	Label         string    `parquet:"label,dict"`
+	TripID        string    `parquet:"trip_id,dict"`
+	TripNumber    string    `parquet:"trip_number,dict"`
+	TripShortName string    `parquet:"trip_short_name,dict"`
+	Route         string    `parquet:"route,dict"`
+	Mode          string    `parquet:"mode,dict"`
+	Headsign      string    `parquet:"headsign,dict"`
+	Lat           float64   `parquet:"lat"`
+	Lon           float64   `parquet:"lon"`
+	Speed         float64   `parquet:"speed"`
+	Heading       float64   `parquet:"heading"`
+	LastUpdated   time.Time `parquet:"last_updated,timestamp(millisecond)"`
+	StopStatus    string    `parquet:"stop_status,dict"`
+	NextStopID    string    `parquet:"next_stop_id,dict"`
+	NextStopName  string    `parquet:"next_stop_name,dict"`
+	Delay         int64     `parquet:"delay"`
+	Cancelled     bool      `parquet:"cancelled"`
+}
+
+// StoptimeRow is one stop of the trip of a vehicle in one snapshot, times
+// are seconds after the start of the service day.
+type StoptimeRow struct {
+	SnapshotTime       time.Time `parquet:"snapshot_time,timestamp(millisecond)"`
+	VehicleID          string    `parquet:"vehicle_id,dict"`
+	TripID             string    `parquet:"trip_id,dict"`
+	TripNumber         string    `parquet:"trip_number,dict"`
+	ServiceDay         time.Time `parquet:"service_day,timestamp(millisecond)"`
+	StopSequence       int32     `parquet:"stop_sequence"`
+	StopID             string    `parquet:"stop_id,dict"`
+	StopName           string    `parquet:"stop_name,dict"`
+	PlatformCode       string    `parquet:"platform_code,dict"`
+	ScheduledArrival   int64     `parquet:"scheduled_arrival"`
+	ScheduledDeparture int64     `parquet:"scheduled_departure"`
+	RealtimeArrival    int64     `parquet:"realtime_arrival"`
+	RealtimeDeparture  int64     `parquet:"realtime_departure"`
+	ArrivalDelay       int64     `parquet:"arrival_delay"`
+	DepartureDelay     int64     `parquet:"departure_delay"`
+	Cancelled          bool      `parquet:"cancelled"`
+}
+
+func snapshotTime(data api.Holavonat) time.Time {
+	if data.LastUpdated == 0 {
+		return time.Now().Truncate(time.Second)
+	}
+	return time.Unix(data.LastUpdated, 0)
+}
+
+// Positions flattens the vehicles of data.
+func Positions(data api.Holavonat) []PositionRow {
+	at := snapshotTime(data)
+	rows := make([]PositionRow, 0, len(data.VehiclePositions))
+	for _, vehicle := range data.VehiclePositions {
+		trip := vehicle.Trip
+		row := PositionRow{
+			SnapshotTime:  at,
+			VehicleID:     vehicle.VehicleID,
+			Label:         vehicle.Label,
+			TripID:        trip.GtfsID,
+			TripNumber:    trip.TripNumber,
+			TripShortName: trip.TripShortName,
+			Route:         trip.Route.ShortName,
+			Mode:          trip.Route.Mode,
+			Headsign:      trip.TripHeadsign,
+			Lat:           vehicle.Lat,
+			Lon:           vehicle.Lon,
+			Speed:         vehicle.Speed,
+			Heading:       vehicle.Heading,
+			LastUpdated:   time.Unix(int64(vehicle.LastUpdated), 0),
+			StopStatus:    vehicle.StopRelationship.Status,
+			Cancelled:     trip.Cancelled,
+		}
+
+		now := row.LastUpdated
+		if vehicle.LastUpdated == 0 {
+			now = at
+		}
+		if i := vehicle.CurrentStoptime(now); i >= 0 {
+			stop := trip.Stoptimes[i].Stop
+			row.NextStopID = stop.GtfsID
+			row.NextStopName = stop.Name
+		}
+		row.Delay = vehicle.Delay(now)
+
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Stoptimes flattens the stoptimes of the trip of every vehicle in data.
+func Stoptimes(data api.Holavonat) []StoptimeRow {
+	at := snapshotTime(data)
+	var rows []StoptimeRow
+	for _, vehicle := range data.VehiclePositions {
+		trip := vehicle.Trip
+		for i, stoptime := range trip.Stoptimes {
+			rows = append(rows, StoptimeRow{
+				SnapshotTime:       at,
+				VehicleID:          vehicle.VehicleID,
+				TripID:             trip.GtfsID,
+				TripNumber:         trip.TripNumber,
+				ServiceDay:         time.Unix(stoptime.ServiceDay, 0),
+				StopSequence:       int32(i),
+				StopID:             stoptime.Stop.GtfsID,
+				StopName:           stoptime.Stop.Name,
+				PlatformCode:       stoptime.Stop.PlatformCode,
+				ScheduledArrival:   stoptime.ScheduledArrival,
+				ScheduledDeparture: stoptime.ScheduledDeparture,
+				RealtimeArrival:    stoptime.RealtimeArrival,
+				RealtimeDeparture:  stoptime.RealtimeDeparture,
+				ArrivalDelay:       stoptime.ArrivalDelay,
+				DepartureDelay:     stoptime.DepartureDelay,
+				Cancelled:          slices.Contains(trip.CancelledStops, stoptime.Stop.GtfsID),
+			})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,148 @@
+package columnar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+const (
+	ContentType = "application/vnd.apache.parquet"
+
+	TablePositions = "positions"
+	TableStoptimes = "stoptimes"
+)
+
+// Partition is the hive style partition of t in Budapest time.
+func Partition(t time.Time) string {
+	t = t.In(api.Location)
+	return fmt.Sprintf("date=%s/hour=%02d", t.Format(time.DateOnly), t.Hour())
+}
+
+type table[T any] struct {
+	file   *os.File
+	writer *parquet.GenericWriter[T]
+}
+
+func openTable[T any](dir string) (*table[T], error) {
+	file, err := os.CreateTemp(dir, "holavonatis-*.parquet")
+	if err != nil {
+		return nil, err
+	}
+	return &table[T]{
+		file:   file,
+		writer: parquet.NewGenericWriter[T](file, parquet.Compression(&zstd.Codec{}), parquet.MaxRowsPerRowGroup(100_000)),
+	}, nil
+}
+
+// Encode writes rows as a single Parquet file.
+func Encode[T any](rows []T) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := parquet.NewGenericWriter[T](&buf, parquet.Compression(&zstd.Codec{}))
+	if _, err := writer.Write(rows); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// finish closes the table and returns the Parquet file.
+func (t *table[T]) finish() ([]byte, error) {
+	defer os.Remove(t.file.Name())
+	defer t.file.Close()
+
+	if err := t.writer.Close(); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(t.file.Name())
+}
+
+// Writer rolls the snapshots of an hour up into one positions and one
+// stoptimes Parquet file under {Path}/{table}/date=YYYY-MM-DD/hour=HH/. The
+// open hour is buffered in temporary files under Dir and published when the
+// first snapshot of the next hour arrives or on Flush.
+type Writer struct {
+	Publisher *output.Publisher
+	Path      string
+	Dir       string
+
+	partition string
+	part      string
+	positions *table[PositionRow]
+	stoptimes *table[StoptimeRow]
+}
+
+func (w *Writer) Write(ctx context.Context, data api.Holavonat) error {
+	at := snapshotTime(data)
+	var errs []error
+	if partition := Partition(at); partition != w.partition {
+		if w.partition != "" {
+			errs = append(errs, w.Flush(ctx))
+		}
+		w.partition = partition
+		w.part = fmt.Sprintf("part-%d.parquet", at.Unix())
+	}
+
+	if w.positions == nil {
+		positions, err := openTable[PositionRow](w.Dir)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		stoptimes, err := openTable[StoptimeRow](w.Dir)
+		if err != nil {
+			positions.file.Close()
+			os.Remove(positions.file.Name())
+			return errors.Join(append(errs, err)...)
+		}
+		w.positions, w.stoptimes = positions, stoptimes
+	}
+
+	if _, err := w.positions.writer.Write(Positions(data)); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := w.stoptimes.writer.Write(Stoptimes(data)); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Flush publishes the open hour, the next Write starts a new part.
+func (w *Writer) Flush(ctx context.Context) error {
+	if w.positions == nil {
+		return nil
+	}
+	positions, stoptimes := w.positions, w.stoptimes
+	w.positions, w.stoptimes = nil, nil
+	partition, part := w.partition, w.part
+	w.partition = ""
+
+	var errs []error
+	for name, finish := range map[string]func() ([]byte, error){
+		TablePositions: positions.finish,
+		TableStoptimes: stoptimes.finish,
+	} {
+		raw, err := finish()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		errs = append(errs, w.Publisher.Publish(ctx, output.Object{
+			Name:          path.Join(w.Path, name, partition, part),
+			ContentType:   ContentType,
+			NoCompression: true,
+			Archive:       true,
+		}, raw))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package columnar_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/parquet-go/parquet-go"
+	r "github.com/stretchr/testify/require"
+)
+
+func snapshot(at time.Time, lat float64) api.Holavonat {
+	serviceDay := api.ServiceDayStart(at).Unix()
+	return api.Holavonat{
+		LastUpdated: at.Unix(),
+		VehiclePositions: []api.VehiclePositions{{
+			VehicleID:   "v1",
+			Lat:         lat,
+			Lon:         19.04,
+			LastUpdated: int(at.Unix()),
+			Trip: api.Trip{
+				GtfsID:         "1:t1",
+				TripNumber:     "2612",
+				Route:          api.Route{ShortName: "S70", Mode: "RAIL"},
+				CancelledStops: []string{"1:c"},
+				Stoptimes: []api.Stoptimes{
+					{Stop: api.Stop{GtfsID: "1:a", Name: "A"}, ServiceDay: serviceDay, RealtimeArrival: 7 * 3600, ArrivalDelay: 60},
+					{Stop: api.Stop{GtfsID: "1:b", Name: "B"}, ServiceDay: serviceDay, RealtimeArrival: 9 * 3600, ArrivalDelay: 120},
+					{Stop: api.Stop{GtfsID: "1:c", Name: "C"}, ServiceDay: serviceDay, RealtimeArrival: 10 * 3600},
+				},
+			},
+		}},
+	}
+}
+
+func read[T any](t *testing.T, name string) []T {
+	raw, err := os.ReadFile(name)
+	r.NoError(t, err)
+	rows, err := parquet.Read[T](bytes.NewReader(raw), int64(len(raw)))
+	r.NoError(t, err)
+	return rows
+}
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs, err := output.NewFilesystem(dir)
+	r.NoError(t, err)
+
+	writer := &columnar.Writer{
+		Publisher: &output.Publisher{Destinations: []output.Destination{{Name: "file", Sink: fs, Compression: output.EncodingGzip}}},
+		Path:      "parquet",
+		Dir:       t.TempDir(),
+	}
+
+	start := time.Date(2025, 7, 1, 7, 30, 0, 0, api.Location)
+	r.NoError(t, writer.Write(ctx, snapshot(start, 47.5)))
+	r.NoError(t, writer.Write(ctx, snapshot(start.Add(time.Minute), 47.6)))
+	r.NoError(t, writer.Write(ctx, snapshot(start.Add(time.Hour), 47.7)))
+
+	positions := read[columnar.PositionRow](t, filepath.Join(dir, "parquet", "positions", "date=2025-07-01", "hour=07", "part-1751347800.parquet"))
+	r.Len(t, positions, 2)
+	r.Equal(t, 47.6, positions[1].Lat)
+	r.Equal(t, "1:b", positions[0].NextStopID)
+	r.Equal(t, int64(120), positions[0].Delay)
+	r.Equal(t, start.Unix(), positions[0].SnapshotTime.Unix())
+
+	stoptimes := read[columnar.StoptimeRow](t, filepath.Join(dir, "parquet", "stoptimes", "date=2025-07-01", "hour=07", "part-1751347800.parquet"))
+	r.Len(t, stoptimes, 6)
+	r.Equal(t, int32(2), stoptimes[2].StopSequence)
+	r.True(t, stoptimes[2].Cancelled)
+
+	// The next hour is published on Flush.
+	r.NoError(t, writer.Flush(ctx))
+	positions = read[columnar.PositionRow](t, filepath.Join(dir, "parquet", "positions", "date=2025-07-01", "hour=08", "part-1751351400.parquet"))
+	r.Len(t, positions, 1)
+	r.NoError(t, writer.Flush(ctx))
+
+	r.Equal(t, "date=2025-10-26/hour=02", columnar.Partition(time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC)))
+}
+
+func TestEncode(t *testing.T) {
+	raw, err := columnar.Encode(columnar.Stoptimes(snapshot(time.Date(2025, 7, 1, 8, 0, 0, 0, api.Location), 47.5)))
+	r.NoError(t, err)
+	rows, err := parquet.Read[columnar.StoptimeRow](bytes.NewReader(raw), int64(len(raw)))
+	r.NoError(t, err)
+	r.Len(t, rows, 3)
+	r.True(t, rows[2].Cancelled)
+}
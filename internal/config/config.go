@@ -3,15 +3,20 @@ package config
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 var (
 	ErrMissingGraphqlEndpoint = errors.New("missing GraphQL endpoint in configuration")
-	ErrMissingCronMode        = errors.New("missing cron mode in configuration (should be 'fix' or 'window')")
-	ErrInvalidCronMode        = errors.New("invalid cron mode, should be 'fix' or 'window'")
+	ErrMissingCronMode        = errors.New("missing cron mode in configuration (should be 'fix', 'window', 'schedule' or 'adaptive')")
+	ErrInvalidCronMode        = errors.New("invalid cron mode, should be 'fix', 'window', 'schedule' or 'adaptive'")
 	ErrEULANotAccepted        = errors.New("EULA not accepted, please set EulaAccepted to true in the configuration (config.yaml)")
+	ErrInvalidSinkType        = errors.New("invalid sink type, should be 'r2' or 'file'")
+	ErrDuplicateSinkName      = errors.New("duplicate sink name")
+	ErrInvalidAdaptive        = errors.New("invalid adaptive mode, Min should be positive and not above Max")
+	ErrInvalidPartialData     = errors.New("invalid partial data handling, should be 'publish' or 'fail'")
 )
 
 func GetConfig() (Config, error) {
@@ -48,9 +53,139 @@ func GetConfig() (Config, error) {
 		return Config{}, ErrMissingCronMode
 	}
 
-	if config.Cron.Mode != "fix" && config.Cron.Mode != "window" {
+	if config.Cron.Mode != Fix && config.Cron.Mode != Window && config.Cron.Mode != Schedule && config.Cron.Mode != Adaptive {
 		return Config{}, ErrInvalidCronMode
 	}
 
+	if config.Cron.Mode == Adaptive {
+		adaptive := &config.Cron.Adaptive
+		if adaptive.Min <= 0 || adaptive.Max < adaptive.Min {
+			return Config{}, ErrInvalidAdaptive
+		}
+		if adaptive.ErrorMax <= 0 {
+			adaptive.ErrorMax = 10 * adaptive.Max
+		}
+	}
+
+	if config.Alerts.Name == "" {
+		config.Alerts.Name = "alerts"
+	}
+
+	if config.Alerts.Retention <= 0 {
+		config.Alerts.Retention = 24 * time.Hour
+	}
+
+	if config.Cancellations.Name == "" {
+		config.Cancellations.Name = "cancellations"
+	}
+
+	if config.Cancellations.Lookback <= 0 {
+		config.Cancellations.Lookback = 2 * time.Hour
+	}
+
+	if config.Cancellations.Lookahead <= 0 {
+		config.Cancellations.Lookahead = 12 * time.Hour
+	}
+
+	if config.Output.V4.NamePrefix == "" {
+		config.Output.V4.NamePrefix = config.Output.NamePrefix + "_v4"
+	}
+
+	if config.Output.Delta.Keep <= 0 {
+		config.Output.Delta.Keep = 60
+	}
+
+	if config.Output.Parquet.Path == "" {
+		config.Output.Parquet.Path = "parquet"
+	}
+
+	if config.Events.Name == "" {
+		config.Events.Name = "events"
+	}
+
+	if config.Events.Retention <= 0 {
+		config.Events.Retention = 6 * time.Hour
+	}
+
+	if config.Events.VanishAfter <= 0 {
+		config.Events.VanishAfter = 5 * time.Minute
+	}
+
+	if config.Punctuality.Name == "" {
+		config.Punctuality.Name = "punctuality"
+	}
+
+	if config.Punctuality.Worst <= 0 {
+		config.Punctuality.Worst = 10
+	}
+
+	if config.History.Retention <= 0 {
+		config.History.Retention = 30 * 24 * time.Hour
+	}
+
+	if config.Reference.Path == "" {
+		config.Reference.Path = "reference"
+	}
+
+	if config.Shutdown.GracePeriod <= 0 {
+		config.Shutdown.GracePeriod = 8
+	}
+
+	if config.Metrics.StaleIntervals <= 0 {
+		config.Metrics.StaleIntervals = 3
+	}
+
+	if config.Network.PartialData == "" {
+		config.Network.PartialData = Publish
+	}
+
+	if config.Network.PartialData != Publish && config.Network.PartialData != Fail {
+		return Config{}, ErrInvalidPartialData
+	}
+
+	config.Sinks, err = normalizeSinks(config)
+	if err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
+
+// normalizeSinks appends the legacy ObjectStorage and File blocks to the
+// configured sinks and validates the result.
+func normalizeSinks(config Config) ([]Sink, error) {
+	sinks := append([]Sink{}, config.Sinks...)
+
+	if config.ObjectStorage.AccessKeyID != "" || config.ObjectStorage.SecretAccessKey != "" || config.ObjectStorage.EndpointURL != "" {
+		sinks = append(sinks, Sink{
+			Name:          "objectstorage",
+			Type:          R2,
+			Compression:   config.ObjectStorage.Compression,
+			ObjectStorage: config.ObjectStorage,
+		})
+	}
+
+	if config.File.Path != "" {
+		sinks = append(sinks, Sink{
+			Name: "file",
+			Type: FS,
+			File: config.File,
+		})
+	}
+
+	names := make(map[string]bool)
+	for i := range sinks {
+		if sinks[i].Type != R2 && sinks[i].Type != FS {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSinkType, sinks[i].Type)
+		}
+		if sinks[i].Name == "" {
+			sinks[i].Name = fmt.Sprintf("%s-%d", sinks[i].Type, i)
+		}
+		if names[sinks[i].Name] {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateSinkName, sinks[i].Name)
+		}
+		names[sinks[i].Name] = true
+	}
+
+	return sinks, nil
+}
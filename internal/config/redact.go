@@ -0,0 +1,51 @@
+package config
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const Redacted = "REDACTED"
+
+// sensitiveHeaders are the substrings of header names whose values are
+// redacted.
+var sensitiveHeaders = []string{"auth", "cookie", "token", "key", "secret"}
+
+// Redact returns a copy of config with the credentials replaced, so it can
+// be printed.
+func Redact(config Config) Config {
+	config.ObjectStorage = redactStorage(config.ObjectStorage)
+
+	config.Sinks = slices.Clone(config.Sinks)
+	for i := range config.Sinks {
+		config.Sinks[i].ObjectStorage = redactStorage(config.Sinks[i].ObjectStorage)
+	}
+
+	config.Headers = maps.Clone(config.Headers)
+	for name := range config.Headers {
+		if slices.ContainsFunc(sensitiveHeaders, func(s string) bool { return strings.Contains(strings.ToLower(name), s) }) {
+			config.Headers[name] = Redacted
+		}
+	}
+
+	if proxy, err := url.Parse(config.Network.Proxy); err == nil && proxy.User != nil {
+		if _, ok := proxy.User.Password(); ok {
+			proxy.User = url.UserPassword(proxy.User.Username(), Redacted)
+			config.Network.Proxy = proxy.String()
+		}
+	}
+
+	return config
+}
+
+func redactStorage(storage ObjectStorage) ObjectStorage {
+	if storage.AccessKeyID != "" {
+		storage.AccessKeyID = Redacted
+	}
+	if storage.SecretAccessKey != "" {
+		storage.SecretAccessKey = Redacted
+	}
+	return storage
+}
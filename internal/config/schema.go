@@ -1,9 +1,20 @@
 package config
 
 import (
+	"io/fs"
+	"time"
+
 	"github.com/holavonat/holavonatis/internal/api"
-	"github.com/holavonat/holavonatis/internal/cloudflare/r2"
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/delta"
+	"github.com/holavonat/holavonatis/internal/events"
+	"github.com/holavonat/holavonatis/internal/flat"
+	"github.com/holavonat/holavonatis/internal/history"
 	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/normalized"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/punctuality"
+	"github.com/holavonat/holavonatis/internal/stream"
 )
 
 type Compression string
@@ -12,16 +23,26 @@ type TimeFrame string
 
 type CronMode string
 
+type PartialData string
+
+type SinkType string
+
 const (
-	Second TimeFrame   = "second"
-	Minute TimeFrame   = "minute"
-	Hour   TimeFrame   = "hour"
-	Brotli Compression = "br"
-	Gzip   Compression = "gzip"
-	Zstd   Compression = "zstd"
-	None   Compression = "none"
-	Fix    CronMode    = "fix"
-	Window CronMode    = "window"
+	Second   TimeFrame   = "second"
+	Minute   TimeFrame   = "minute"
+	Hour     TimeFrame   = "hour"
+	Brotli   Compression = "br"
+	Gzip     Compression = "gzip"
+	Zstd     Compression = "zstd"
+	None     Compression = "none"
+	Fix      CronMode    = "fix"
+	Window   CronMode    = "window"
+	Schedule CronMode    = "schedule"
+	Adaptive CronMode    = "adaptive"
+	R2       SinkType    = "r2"
+	FS       SinkType    = "file"
+	Publish  PartialData = "publish"
+	Fail     PartialData = "fail"
 )
 
 type Config struct {
@@ -30,7 +51,18 @@ type Config struct {
 	Source          api.Source        `yaml:"Source"`
 	Network         Network           `yaml:"Network"`
 	GraphqlEndpoint string            `yaml:"graphqlendpoint"`
+	Query           Query             `yaml:"query"`
+	Alerts          Alerts            `yaml:"alerts"`
+	Cancellations   Cancellations     `yaml:"cancellations"`
+	Reference       Reference         `yaml:"reference"`
+	Events          Events            `yaml:"events"`
+	Punctuality     Punctuality       `yaml:"punctuality"`
+	History         History           `yaml:"history"`
 	File            File              `yaml:"file"`
+	Sinks           []Sink            `yaml:"sinks"`
+	Server          Server            `yaml:"server"`
+	Shutdown        Shutdown          `yaml:"shutdown"`
+	Metrics         Metrics           `yaml:"metrics"`
 	Output          Output            `yaml:"output"`
 	Cron            Cron              `yaml:"cron"`
 	Log             log.Config        `yaml:"log"`
@@ -38,13 +70,34 @@ type Config struct {
 }
 
 type Output struct {
-	NamePrefix string `yaml:"nameprefix"`
-	Format     Format `yaml:"format"`
-	Archive    bool   `yaml:"archive"`
+	NamePrefix string  `yaml:"nameprefix"`
+	Format     Format  `yaml:"format"`
+	Archive    bool    `yaml:"archive"`
+	V4         V4      `yaml:"v4"`
+	Delta      Delta   `yaml:"delta"`
+	Parquet    Parquet `yaml:"parquet"`
+	Flat       Flat    `yaml:"flat"`
 }
 
+// Format selects the outputs published next to the JSON snapshot. JSON is
+// always written, as the delta feed, the server and the archives read it.
 type Format struct {
-	JSON bool `yaml:"json"`
+	JSON    bool `yaml:"json"`
+	GTFSRT  bool `yaml:"gtfsrt"`
+	V4      bool `yaml:"v4"`
+	Delta   bool `yaml:"delta"`
+	GeoJSON bool `yaml:"geojson"`
+	Parquet bool `yaml:"parquet"`
+	NDJSON  bool `yaml:"ndjson"`
+	CSV     bool `yaml:"csv"`
+}
+
+// V4 is the normalized snapshot, the stops and geometries are written to
+// {NamePrefix}_stops.json and {NamePrefix}_geometries.json when they change.
+// Inline also embeds them in the snapshot that changed them.
+type V4 struct {
+	NamePrefix string `yaml:"nameprefix"`
+	Inline     bool   `yaml:"inline"`
 }
 
 type ObjectStorage struct {
@@ -61,11 +114,38 @@ type File struct {
 	Path string `yaml:"path"`
 }
 
+type Sink struct {
+	Name          string        `yaml:"name"`
+	Type          SinkType      `yaml:"type"`
+	Compression   Compression   `yaml:"compression"`
+	ObjectStorage ObjectStorage `yaml:"objectstorage"`
+	File          File          `yaml:"file"`
+}
+
+type Server struct {
+	Listen  string `yaml:"listen"`
+	Static  string `yaml:"static"`
+	DataURL string `yaml:"dataurl"`
+	Archive string `yaml:"archive"`
+	Stream  bool   `yaml:"stream"`
+}
+
+type Metrics struct {
+	Listen         string `yaml:"listen"`
+	StaleIntervals int    `yaml:"staleintervals"`
+}
+
+type Shutdown struct {
+	GracePeriod int `yaml:"graceperiod"`
+}
+
 type Cron struct {
-	Mode     CronMode   `yaml:"mode"`
-	Duration TimeFrame  `yaml:"duration"`
-	Fix      FixMode    `yaml:"fix"`
-	Window   WindowMode `yaml:"window"`
+	Mode     CronMode     `yaml:"mode"`
+	Duration TimeFrame    `yaml:"duration"`
+	Fix      FixMode      `yaml:"fix"`
+	Window   WindowMode   `yaml:"window"`
+	Schedule ScheduleMode `yaml:"schedule"`
+	Adaptive AdaptiveMode `yaml:"adaptive"`
 }
 
 type FixMode struct {
@@ -77,12 +157,157 @@ type WindowMode struct {
 	Max int `yaml:"max"`
 }
 
+type AdaptiveMode struct {
+	Min        int `yaml:"min"`
+	Max        int `yaml:"max"`
+	ErrorMax   int `yaml:"errormax"`
+	MinChanges int `yaml:"minchanges"`
+}
+
+// ScheduleMode runs at the earliest of the cron expressions and the first
+// matching time-of-day rule, evaluated in Europe/Budapest.
+type ScheduleMode struct {
+	Expressions []string       `yaml:"expressions"`
+	Rules       []ScheduleRule `yaml:"rules"`
+}
+
+type ScheduleRule struct {
+	From     string        `yaml:"from"`
+	To       string        `yaml:"to"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type Query struct {
+	Template  string          `yaml:"template"`
+	Templates []QueryTemplate `yaml:"templates"`
+	BBox      api.BBox        `yaml:"bbox"`
+	Modes     []string        `yaml:"modes"`
+	Language  string          `yaml:"language"`
+	Tiles     int             `yaml:"tiles"`
+	Workers   int             `yaml:"workers"`
+}
+
+// Alerts fetches the network-wide service alerts every Interval, disabled
+// when zero. The filters are passed to the alerts query.
+type Alerts struct {
+	Interval      time.Duration `yaml:"interval"`
+	Retention     time.Duration `yaml:"retention"`
+	Name          string        `yaml:"name"`
+	Template      string        `yaml:"template"`
+	Feeds         []string      `yaml:"feeds"`
+	SeverityLevel []string      `yaml:"severitylevel"`
+	Effect        []string      `yaml:"effect"`
+	Cause         []string      `yaml:"cause"`
+	Route         []string      `yaml:"route"`
+	Stop          []string      `yaml:"stop"`
+}
+
+// Cancellations fetches the trips cancelled between now-Lookback and
+// now+Lookahead every Interval, disabled when zero.
+type Cancellations struct {
+	Interval  time.Duration `yaml:"interval"`
+	Lookback  time.Duration `yaml:"lookback"`
+	Lookahead time.Duration `yaml:"lookahead"`
+	Name      string        `yaml:"name"`
+	Template  string        `yaml:"template"`
+	Feeds     []string      `yaml:"feeds"`
+	Routes    []string      `yaml:"routes"`
+}
+
+// Reference exports the stops, stations, routes, patterns, agencies and feeds
+// under Path every Interval, disabled when zero. Replaced versions are
+// deleted unless Keep is set.
+type Reference struct {
+	Interval time.Duration `yaml:"interval"`
+	Path     string        `yaml:"path"`
+	Keep     bool          `yaml:"keep"`
+}
+
+// Delta writes {NamePrefix}_delta_{sequence}.json patches between
+// consecutive snapshots and keeps the last Keep of them in the manifest
+// {NamePrefix}_delta.json.
+type Delta struct {
+	Keep int `yaml:"keep"`
+}
+
+// Parquet archives the positions and stoptimes as hourly Parquet files under
+// {Path}/{table}/date=YYYY-MM-DD/hour=HH. The open hour is kept in Dir, the
+// system temporary directory when empty.
+type Parquet struct {
+	Path string `yaml:"path"`
+	Dir  string `yaml:"dir"`
+}
+
+// Flat selects the columns of the NDJSON and CSV outputs. With Daily the rows
+// are also appended to {NamePrefix}_positions_YYYY-MM-DD, or written as parts
+// on the sinks that cannot append. The server does not keep them.
+type Flat struct {
+	Columns []string `yaml:"columns"`
+	Daily   bool     `yaml:"daily"`
+}
+
+// Events infers the arrivals and departures from consecutive snapshots and
+// appends them to {Name}_YYYY-MM-DD.ndjson, and .csv with CSV, by service
+// date, like the daily flat files.
+type Events struct {
+	Enabled     bool          `yaml:"enabled"`
+	Name        string        `yaml:"name"`
+	Retention   time.Duration `yaml:"retention"`
+	VanishAfter time.Duration `yaml:"vanishafter"`
+	CSV         bool          `yaml:"csv"`
+}
+
+// Punctuality publishes the daily punctuality reports every Interval,
+// disabled when zero. Worst is the number of trains listed as the worst.
+type Punctuality struct {
+	Interval time.Duration `yaml:"interval"`
+	Name     string        `yaml:"name"`
+	Worst    int           `yaml:"worst"`
+}
+
+// History writes every snapshot to the SQLite database at Path, disabled
+// when empty, and serves the query API on the HTTP server. Rows older than
+// Retention are pruned hourly.
+type History struct {
+	Path      string        `yaml:"path"`
+	Retention time.Duration `yaml:"retention"`
+}
+
+// QueryTemplate is a named GraphQL document, inline or read from File.
+type QueryTemplate struct {
+	Name  string `yaml:"name"`
+	File  string `yaml:"file"`
+	Query string `yaml:"query"`
+}
+
 type Network struct {
-	Proxy   string `yaml:"proxy"`
-	Timeout int    `yaml:"timeout"`
+	Proxy       string      `yaml:"proxy"`
+	PartialData PartialData `yaml:"partialdata"`
+	Timeout     int         `yaml:"timeout"`
+	Retry       Retry       `yaml:"retry"`
+}
+
+type Retry struct {
+	MaxAttempts int      `yaml:"maxattempts"`
+	BaseBackoff int      `yaml:"basebackoff"`
+	MaxBackoff  int      `yaml:"maxbackoff"`
+	Deadline    int      `yaml:"deadline"`
+	Statuses    []int    `yaml:"statuses"`
+	Errors      []string `yaml:"errors"`
 }
 
 type App struct {
-	ObjectStorage r2.Cloudflare
+	Hub           *stream.Hub
+	Cancellations *api.Cancellations
+	Normalized    *normalized.Encoder
+	Delta         *delta.Feed
+	Columnar      *columnar.Writer
+	Positions     *flat.Table[columnar.PositionRow]
+	Events        *events.Tracker
+	Punctuality   *punctuality.Aggregator
+	History       *history.Store
+	Publisher     output.Publisher
 	Cfg           Config
+	// Assets holds the bundled static folders of Server.Static.
+	Assets fs.FS
 }
@@ -0,0 +1,224 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+var ErrSequence = errors.New("delta does not follow the snapshot")
+
+// Delta turns the snapshot at Base into the one at Sequence. Vehicles are
+// keyed by vehicleId, Changed holds a JSON merge patch (RFC 7396) for every
+// vehicle that changed. Errors and MissingAreas replace the previous ones.
+type Delta struct {
+	Sequence     int64                      `json:"sequence"`
+	Base         int64                      `json:"base"`
+	Timestamp    string                     `json:"timestamp"`
+	LastUpdated  int64                      `json:"lastUpdated"`
+	Errors       api.GraphQLErrors          `json:"errors,omitempty"`
+	MissingAreas []api.BBox                 `json:"missingAreas,omitempty"`
+	Added        []json.RawMessage          `json:"added,omitempty"`
+	Removed      []string                   `json:"removed,omitempty"`
+	Changed      map[string]json.RawMessage `json:"changed,omitempty"`
+}
+
+// Differ numbers the snapshots and diffs each one against the previous.
+type Differ struct {
+	sequence int64
+	previous map[string]json.RawMessage
+}
+
+// Seed continues the numbering after sequence, e.g. after a restart.
+func (d *Differ) Seed(sequence int64) {
+	d.sequence = sequence
+	d.previous = nil
+}
+
+// Diff assigns the next sequence to data and returns the delta from the
+// previous snapshot, nil for the first one.
+func (d *Differ) Diff(data api.Holavonat) (int64, *Delta, error) {
+	current := make(map[string]json.RawMessage, len(data.VehiclePositions))
+	order := make([]string, 0, len(data.VehiclePositions))
+	for _, vehicle := range data.VehiclePositions {
+		raw, err := json.Marshal(vehicle)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, ok := current[vehicle.VehicleID]; !ok {
+			order = append(order, vehicle.VehicleID)
+		}
+		current[vehicle.VehicleID] = raw
+	}
+
+	d.sequence++
+	previous := d.previous
+	d.previous = current
+	if previous == nil {
+		return d.sequence, nil, nil
+	}
+
+	delta := &Delta{
+		Sequence:     d.sequence,
+		Base:         d.sequence - 1,
+		Timestamp:    data.Timestamp,
+		LastUpdated:  data.LastUpdated,
+		Errors:       data.Errors,
+		MissingAreas: data.MissingAreas,
+		Changed:      make(map[string]json.RawMessage),
+	}
+
+	for _, id := range order {
+		before, ok := previous[id]
+		if !ok {
+			delta.Added = append(delta.Added, current[id])
+			continue
+		}
+		patch, changed, err := diff(before, current[id])
+		if err != nil {
+			return 0, nil, err
+		}
+		if changed {
+			delta.Changed[id] = patch
+		}
+	}
+
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+
+	return d.sequence, delta, nil
+}
+
+// Apply patches the snapshot at delta.Base. Vehicles keep their order, the
+// added ones are appended.
+func Apply(snapshot api.Holavonat, sequence int64, delta Delta) (api.Holavonat, error) {
+	if sequence != delta.Base {
+		return api.Holavonat{}, ErrSequence
+	}
+
+	removed := make(map[string]bool, len(delta.Removed))
+	for _, id := range delta.Removed {
+		removed[id] = true
+	}
+
+	vehicles := make([]api.VehiclePositions, 0, len(snapshot.VehiclePositions)+len(delta.Added))
+	for _, vehicle := range snapshot.VehiclePositions {
+		if removed[vehicle.VehicleID] {
+			continue
+		}
+		if patch, ok := delta.Changed[vehicle.VehicleID]; ok {
+			raw, err := json.Marshal(vehicle)
+			if err != nil {
+				return api.Holavonat{}, err
+			}
+			if raw, err = merge(raw, patch); err != nil {
+				return api.Holavonat{}, err
+			}
+			vehicle = api.VehiclePositions{}
+			if err := json.Unmarshal(raw, &vehicle); err != nil {
+				return api.Holavonat{}, err
+			}
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+
+	for _, raw := range delta.Added {
+		var vehicle api.VehiclePositions
+		if err := json.Unmarshal(raw, &vehicle); err != nil {
+			return api.Holavonat{}, err
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+
+	snapshot.VehiclePositions = vehicles
+	snapshot.Timestamp = delta.Timestamp
+	snapshot.LastUpdated = delta.LastUpdated
+	snapshot.Errors = delta.Errors
+	snapshot.MissingAreas = delta.MissingAreas
+	return snapshot, nil
+}
+
+// diff returns the merge patch from before to after. Objects are diffed
+// field by field, everything else is replaced as a whole.
+func diff(before, after json.RawMessage) (json.RawMessage, bool, error) {
+	if bytes.Equal(before, after) {
+		return nil, false, nil
+	}
+	if !isObject(before) || !isObject(after) {
+		return after, true, nil
+	}
+
+	var from, to map[string]json.RawMessage
+	if err := json.Unmarshal(before, &from); err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(after, &to); err != nil {
+		return nil, false, err
+	}
+
+	patch := make(map[string]json.RawMessage)
+	for key, value := range to {
+		previous, ok := from[key]
+		if !ok {
+			patch[key] = value
+			continue
+		}
+		field, changed, err := diff(previous, value)
+		if err != nil {
+			return nil, false, err
+		}
+		if changed {
+			patch[key] = field
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			patch[key] = json.RawMessage("null")
+		}
+	}
+
+	raw, err := json.Marshal(patch)
+	return raw, true, err
+}
+
+// merge applies an RFC 7396 merge patch.
+func merge(target, patch json.RawMessage) (json.RawMessage, error) {
+	if !isObject(patch) {
+		return patch, nil
+	}
+
+	doc := make(map[string]json.RawMessage)
+	if isObject(target) {
+		if err := json.Unmarshal(target, &doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if bytes.Equal(value, []byte("null")) {
+			delete(doc, key)
+			continue
+		}
+		merged, err := merge(doc[key], value)
+		if err != nil {
+			return nil, err
+		}
+		doc[key] = merged
+	}
+
+	return json.Marshal(doc)
+}
+
+func isObject(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '{'
+}
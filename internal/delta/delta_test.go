@@ -0,0 +1,114 @@
+package delta_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/delta"
+	"github.com/holavonat/holavonatis/internal/output"
+	r "github.com/stretchr/testify/require"
+)
+
+func vehicle(id string, lat float64, delay int64) api.VehiclePositions {
+	return api.VehiclePositions{
+		VehicleID:   id,
+		Lat:         lat,
+		Lon:         19.04,
+		LastUpdated: 1751364000,
+		Trip: api.Trip{
+			GtfsID:    "1:" + id,
+			Stoptimes: []api.Stoptimes{{Stop: api.Stop{GtfsID: "1:a"}, ArrivalDelay: delay}},
+		},
+	}
+}
+
+func TestDiffApply(t *testing.T) {
+	var differ delta.Differ
+
+	first := api.Holavonat{Timestamp: "t1", VehiclePositions: []api.VehiclePositions{
+		vehicle("a", 47.5, 0), vehicle("b", 47.6, 0), vehicle("c", 47.7, 0),
+	}}
+	sequence, patch, err := differ.Diff(first)
+	r.NoError(t, err)
+	r.Equal(t, int64(1), sequence)
+	r.Nil(t, patch)
+
+	second := api.Holavonat{Timestamp: "t2", VehiclePositions: []api.VehiclePositions{
+		vehicle("a", 47.5, 0), vehicle("b", 47.65, 60), vehicle("d", 47.8, 0),
+	}}
+	second.MissingAreas = []api.BBox{{SwLat: 1}}
+	sequence, patch, err = differ.Diff(second)
+	r.NoError(t, err)
+	r.Equal(t, int64(2), sequence)
+	r.Equal(t, int64(1), patch.Base)
+	r.Equal(t, []string{"c"}, patch.Removed)
+	r.Len(t, patch.Added, 1)
+	r.Len(t, patch.Changed, 1)
+	r.JSONEq(t, `{"lat":47.65,"trip":{"stoptimes":[{"stop":{"name":"","platformCode":"","lat":0,"lon":0,"gtfsId":"1:a"},"realtimeArrival":0,"realtimeDeparture":0,"arrivalDelay":60,"departureDelay":0,"scheduledArrival":0,"scheduledDeparture":0}]}}`, string(patch.Changed["b"]))
+
+	// The patch travels as JSON.
+	raw, err := json.Marshal(patch)
+	r.NoError(t, err)
+	var decoded delta.Delta
+	r.NoError(t, json.Unmarshal(raw, &decoded))
+
+	applied, err := delta.Apply(first, 1, decoded)
+	r.NoError(t, err)
+	r.Equal(t, second, applied)
+
+	_, err = delta.Apply(first, 2, decoded)
+	r.ErrorIs(t, err, delta.ErrSequence)
+}
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+	publisher := &output.Publisher{Destinations: []output.Destination{{Name: "file", Sink: fs}}}
+
+	feed := &delta.Feed{Publisher: publisher, Name: "data_delta", Full: "data.json", Keep: 2}
+	r.NoError(t, feed.Restore(ctx))
+
+	manifest := func() delta.Manifest {
+		raw, err := publisher.Load(ctx, "data_delta.json")
+		r.NoError(t, err)
+		var manifest delta.Manifest
+		r.NoError(t, json.Unmarshal(raw, &manifest))
+		return manifest
+	}
+
+	for i := range 4 {
+		sequence, patch, err := feed.Next(api.Holavonat{VehiclePositions: []api.VehiclePositions{vehicle("a", 47.5+float64(i)/10, 0)}})
+		r.NoError(t, err)
+		r.NoError(t, feed.Publish(ctx, sequence, patch))
+	}
+
+	m := manifest()
+	r.Equal(t, int64(4), m.Sequence)
+	r.Equal(t, int64(2), m.Base)
+	r.Equal(t, "data.json", m.Full)
+	r.Len(t, m.Patches, 2)
+	r.Equal(t, "data_delta_4.json", m.Patches[1].Name)
+
+	_, err = publisher.Load(ctx, "data_delta_2.json")
+	r.ErrorIs(t, err, output.ErrNotExist)
+	_, err = publisher.Load(ctx, "data_delta_3.json")
+	r.NoError(t, err)
+
+	// After a restart the numbering goes on, but the chain starts over.
+	feed = &delta.Feed{Publisher: publisher, Name: "data_delta", Full: "data.json", Keep: 2}
+	r.NoError(t, feed.Restore(ctx))
+	sequence, patch, err := feed.Next(api.Holavonat{})
+	r.NoError(t, err)
+	r.Nil(t, patch)
+	r.NoError(t, feed.Publish(ctx, sequence, patch))
+
+	m = manifest()
+	r.Equal(t, int64(5), m.Sequence)
+	r.Equal(t, int64(5), m.Base)
+	r.Empty(t, m.Patches)
+	_, err = publisher.Load(ctx, "data_delta_4.json")
+	r.ErrorIs(t, err, output.ErrNotExist)
+}
@@ -0,0 +1,122 @@
+package delta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/output"
+)
+
+type Patch struct {
+	Sequence int64  `json:"sequence"`
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+}
+
+// Manifest lists the patches leading from Base to Sequence. A client holding
+// the snapshot of a sequence before Base has to reload Full.
+type Manifest struct {
+	Sequence  int64   `json:"sequence"`
+	Base      int64   `json:"base"`
+	Timestamp string  `json:"timestamp"`
+	Full      string  `json:"full"`
+	Patches   []Patch `json:"patches"`
+}
+
+// Feed publishes {Name}_{sequence}.json for every cycle and {Name}.json as
+// the manifest, keeping the last Keep patches.
+type Feed struct {
+	Publisher *output.Publisher
+	Name      string
+	Full      string
+	Keep      int
+
+	differ    Differ
+	manifest  Manifest
+	timestamp string
+}
+
+// Restore continues the sequence of the previous manifest. The chain of
+// patches is broken by the restart, so they are removed on the next Publish.
+func (f *Feed) Restore(ctx context.Context) error {
+	raw, err := f.Publisher.Load(ctx, f.Name+".json")
+	if errors.Is(err, output.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &f.manifest); err != nil {
+		return err
+	}
+	f.differ.Seed(f.manifest.Sequence)
+	return nil
+}
+
+// Next numbers data and returns the delta from the previous cycle.
+func (f *Feed) Next(data api.Holavonat) (int64, *Delta, error) {
+	f.timestamp = data.Timestamp
+	return f.differ.Diff(data)
+}
+
+// Publish writes the patch, when there is one, and the manifest. Without a
+// patch the chain restarts at the sequence of the current snapshot.
+func (f *Feed) Publish(ctx context.Context, sequence int64, delta *Delta) error {
+	var errs []error
+	stale := f.manifest.Patches
+
+	if delta == nil {
+		f.manifest.Base = sequence
+		f.manifest.Patches = nil
+	} else {
+		raw, err := json.Marshal(delta)
+		if err != nil {
+			return err
+		}
+
+		patch := Patch{
+			Sequence: delta.Sequence,
+			Name:     fmt.Sprintf("%s_%d.json", f.Name, delta.Sequence),
+			Size:     len(raw),
+		}
+		if err := f.Publisher.Publish(ctx, output.Object{
+			Name:        patch.Name,
+			ContentType: "application/json",
+		}, raw); err != nil {
+			// The chain is broken, clients have to reload the full snapshot.
+			f.manifest.Base = sequence
+			f.manifest.Patches = nil
+			errs = append(errs, err)
+		} else {
+			f.manifest.Patches = append(f.manifest.Patches, patch)
+			stale = nil
+			if keep := max(f.Keep, 1); len(f.manifest.Patches) > keep {
+				stale = f.manifest.Patches[:len(f.manifest.Patches)-keep]
+				f.manifest.Patches = f.manifest.Patches[len(f.manifest.Patches)-keep:]
+				f.manifest.Base = f.manifest.Patches[0].Sequence - 1
+			}
+		}
+	}
+
+	f.manifest.Sequence = sequence
+	f.manifest.Timestamp = f.timestamp
+	f.manifest.Full = f.Full
+
+	raw, err := json.Marshal(f.manifest)
+	if err != nil {
+		return err
+	}
+	errs = append(errs, f.Publisher.Publish(ctx, output.Object{
+		Name:        f.Name + ".json",
+		ContentType: "application/json",
+	}, raw))
+
+	for _, patch := range stale {
+		errs = append(errs, f.Publisher.Delete(ctx, patch.Name))
+	}
+
+	return errors.Join(errs...)
+}
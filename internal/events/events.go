@@ -0,0 +1,244 @@
+package events
+
+import (
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+const (
+	Arrival   = "arrival"
+	Departure = "departure"
+
+	// SourceStopped is a STOPPED_AT transition, SourcePassed a stop the
+	// vehicle was seen beyond without stopping in between two snapshots.
+	// SourceVanished is the arrival at the last stop of a vehicle that was
+	// heading there and disappeared or started another trip, its Observed
+	// is the last realtime arrival.
+	SourceStopped  = "stopped"
+	SourcePassed   = "passed"
+	SourceVanished = "vanished"
+
+	StoppedAt = "STOPPED_AT"
+)
+
+// Event is an arrival at or a departure from a stop of a trip. Observed is
+// the first snapshot showing it, Realtime and Scheduled are the upstream
+// times, Delay is the upstream delay in seconds.
+type Event struct {
+	ServiceDate   string `json:"serviceDate"`
+	Kind          string `json:"kind"`
+	Source        string `json:"source"`
+	VehicleID     string `json:"vehicleId"`
+	TripID        string `json:"tripId"`
+	TripNumber    string `json:"tripNumber,omitempty"`
+	Route         string `json:"route,omitempty"`
+	StopID        string `json:"stopId"`
+	StopName      string `json:"stopName,omitempty"`
+	StopSequence  int    `json:"stopSequence"`
+	Observed      int64  `json:"observed"`
+	Realtime      int64  `json:"realtime"`
+	Scheduled     int64  `json:"scheduled"`
+	Delay         int64  `json:"delay"`
+	ObservedDelay int64  `json:"observedDelay"`
+}
+
+// ServiceDate is the date of the service day starting at serviceDay, which
+// is noon minus 12 hours and so not always midnight.
+func ServiceDate(serviceDay int64) string {
+	return time.Unix(serviceDay+12*3600, 0).In(api.Location).Format(time.DateOnly)
+}
+
+type vehicle struct {
+	trip     string
+	stop     int
+	stopped  bool
+	lastSeen time.Time
+	position api.VehiclePositions
+}
+
+type key struct {
+	trip     string
+	sequence int
+	kind     string
+}
+
+// Tracker follows every vehicle across snapshots and emits each event of a
+// trip stop once. A vehicle seen for the first time only sets the baseline.
+type Tracker struct {
+	// Retention is how long a vehicle and its emitted events are remembered
+	// after it was last seen.
+	Retention time.Duration
+	// VanishAfter is how long a vehicle heading to its last stop has to be
+	// unseen before its arrival there is emitted as vanished.
+	VanishAfter time.Duration
+
+	vehicles map[string]*vehicle
+	emitted  map[key]time.Time
+}
+
+func NewTracker(retention, vanishAfter time.Duration) *Tracker {
+	return &Tracker{
+		Retention:   retention,
+		VanishAfter: vanishAfter,
+		vehicles:    make(map[string]*vehicle),
+		emitted:     make(map[key]time.Time),
+	}
+}
+
+func (t *Tracker) Observe(data api.Holavonat) []Event {
+	snapshot := time.Unix(data.LastUpdated, 0)
+
+	var events []Event
+	for _, v := range data.VehiclePositions {
+		stoptimes := v.Trip.Stoptimes
+		if v.VehicleID == "" || len(stoptimes) == 0 {
+			continue
+		}
+
+		now := snapshot
+		if v.LastUpdated > 0 {
+			now = time.Unix(int64(v.LastUpdated), 0)
+		}
+
+		trip := v.Trip.GtfsID + "@" + ServiceDate(stoptimes[0].ServiceDay)
+		previous, ok := t.vehicles[v.VehicleID]
+
+		// A stop visited twice, e.g. on a loop, resolves to the visit at or
+		// after the last known position, after it once the vehicle left.
+		current := v.CurrentStoptime(now)
+		from := max(current-1, 0)
+		if ok && previous.trip == trip {
+			from = previous.stop
+			if previous.stopped && v.StopRelationship.Status != StoppedAt {
+				from++
+			}
+		}
+		stop := stopIndex(stoptimes, v.StopRelationship.Stop.GtfsID, from)
+		stopped := stop >= 0 && v.StopRelationship.Status == StoppedAt
+		if stop < 0 {
+			stop = current
+		}
+
+		t.vehicles[v.VehicleID] = &vehicle{trip: trip, stop: stop, stopped: stopped, lastSeen: snapshot, position: v}
+		if ok && previous.trip != trip {
+			events = append(events, t.vanish(previous, snapshot)...)
+		}
+		if !ok || previous.trip != trip {
+			// How long it has been standing there is unknown.
+			if stopped {
+				t.emitted[key{trip, stop, Arrival}] = snapshot
+			}
+			continue
+		}
+
+		emit := func(i int, kind, source string) {
+			k := key{trip, i, kind}
+			if _, ok := t.emitted[k]; ok {
+				return
+			}
+			t.emitted[k] = snapshot
+			events = append(events, newEvent(v, i, kind, source, now))
+		}
+
+		for i := previous.stop; i < stop; i++ {
+			source := SourcePassed
+			if previous.stopped && i == previous.stop {
+				source = SourceStopped
+			}
+			emit(i, Arrival, SourcePassed)
+			emit(i, Departure, source)
+		}
+		if stopped && !(previous.stopped && previous.stop == stop) {
+			emit(stop, Arrival, SourceStopped)
+		}
+	}
+
+	return append(events, t.expire(snapshot)...)
+}
+
+// stopIndex returns the index of the stop id in stoptimes, the first one from
+// index from on, else the first one. -1 when the trip does not stop there.
+func stopIndex(stoptimes []api.Stoptimes, id string, from int) int {
+	if id == "" {
+		return -1
+	}
+	for i := from; i < len(stoptimes); i++ {
+		if stoptimes[i].Stop.GtfsID == id {
+			return i
+		}
+	}
+	for i := range min(from, len(stoptimes)) {
+		if stoptimes[i].Stop.GtfsID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// vanish emits the arrival at the last stop of a vehicle that was heading
+// there when it was seen for the last time on its trip.
+func (t *Tracker) vanish(v *vehicle, now time.Time) []Event {
+	last := len(v.position.Trip.Stoptimes) - 1
+	if v.stop != last || v.stopped {
+		return nil
+	}
+	k := key{v.trip, last, Arrival}
+	if _, ok := t.emitted[k]; ok {
+		return nil
+	}
+	t.emitted[k] = now
+
+	stoptime := v.position.Trip.Stoptimes[last]
+	realtime := time.Unix(stoptime.ServiceDay+stoptime.RealtimeArrival, 0)
+	return []Event{newEvent(v.position, last, Arrival, SourceVanished, realtime)}
+}
+
+func (t *Tracker) expire(now time.Time) []Event {
+	var events []Event
+	for id, v := range t.vehicles {
+		unseen := now.Sub(v.lastSeen)
+		if unseen > t.VanishAfter || unseen > t.Retention {
+			events = append(events, t.vanish(v, now)...)
+		}
+		if unseen > t.Retention {
+			delete(t.vehicles, id)
+		}
+	}
+	for k, seen := range t.emitted {
+		if now.Sub(seen) > t.Retention {
+			delete(t.emitted, k)
+		}
+	}
+	return events
+}
+
+func newEvent(v api.VehiclePositions, i int, kind, source string, observed time.Time) Event {
+	stoptime := v.Trip.Stoptimes[i]
+	event := Event{
+		ServiceDate:  ServiceDate(stoptime.ServiceDay),
+		Kind:         kind,
+		Source:       source,
+		VehicleID:    v.VehicleID,
+		TripID:       v.Trip.GtfsID,
+		TripNumber:   v.Trip.TripNumber,
+		Route:        v.Trip.Route.ShortName,
+		StopID:       stoptime.Stop.GtfsID,
+		StopName:     stoptime.Stop.Name,
+		StopSequence: i,
+		Observed:     observed.Unix(),
+	}
+
+	if kind == Arrival {
+		event.Realtime = stoptime.ServiceDay + stoptime.RealtimeArrival
+		event.Scheduled = stoptime.ServiceDay + stoptime.ScheduledArrival
+		event.Delay = stoptime.ArrivalDelay
+	} else {
+		event.Realtime = stoptime.ServiceDay + stoptime.RealtimeDeparture
+		event.Scheduled = stoptime.ServiceDay + stoptime.ScheduledDeparture
+		event.Delay = stoptime.DepartureDelay
+	}
+	event.ObservedDelay = event.Observed - event.Scheduled
+
+	return event
+}
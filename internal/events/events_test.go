@@ -0,0 +1,147 @@
+package events_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/events"
+	r "github.com/stretchr/testify/require"
+)
+
+var serviceDay = time.Date(2025, 7, 1, 0, 0, 0, 0, api.Location).Unix()
+
+func snapshot(at string, status, stop string) api.Holavonat {
+	t, err := time.ParseInLocation(time.TimeOnly, at, api.Location)
+	if err != nil {
+		panic(err)
+	}
+	now := time.Unix(serviceDay, 0).Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+
+	var stoptimes []api.Stoptimes
+	for i, id := range []string{"1:a", "1:b", "1:c", "1:d"} {
+		scheduled := int64(8*3600 + i*600)
+		stoptimes = append(stoptimes, api.Stoptimes{
+			Stop:               api.Stop{GtfsID: id},
+			ServiceDay:         serviceDay,
+			ScheduledArrival:   scheduled,
+			ScheduledDeparture: scheduled + 60,
+			RealtimeArrival:    scheduled + 120,
+			RealtimeDeparture:  scheduled + 180,
+			ArrivalDelay:       120,
+			DepartureDelay:     120,
+		})
+	}
+
+	return api.Holavonat{
+		LastUpdated: now.Unix(),
+		VehiclePositions: []api.VehiclePositions{{
+			VehicleID:        "v1",
+			LastUpdated:      int(now.Unix()),
+			StopRelationship: api.StopRelationship{Status: status, Stop: api.Stop{GtfsID: stop}},
+			Trip:             api.Trip{GtfsID: "1:t1", TripNumber: "2612", Stoptimes: stoptimes},
+		}},
+	}
+}
+
+type observed struct {
+	kind, source, stop string
+}
+
+func kinds(list []events.Event) []observed {
+	var result []observed
+	for _, event := range list {
+		result = append(result, observed{event.Kind, event.Source, event.StopID})
+	}
+	return result
+}
+
+func TestTracker(t *testing.T) {
+	tracker := events.NewTracker(time.Hour, 5*time.Minute)
+
+	// Standing at the first stop since an unknown time.
+	r.Empty(t, tracker.Observe(snapshot("08:00:00", events.StoppedAt, "1:a")))
+	r.Empty(t, tracker.Observe(snapshot("08:01:00", events.StoppedAt, "1:a")))
+
+	list := tracker.Observe(snapshot("08:03:00", "IN_TRANSIT_TO", "1:b"))
+	r.Equal(t, []observed{{events.Departure, events.SourceStopped, "1:a"}}, kinds(list))
+	departure := list[0]
+	r.Equal(t, "2025-07-01", departure.ServiceDate)
+	r.Equal(t, serviceDay+8*3600+60, departure.Scheduled)
+	r.Equal(t, int64(120), departure.ObservedDelay)
+	r.Equal(t, int64(120), departure.Delay)
+
+	list = tracker.Observe(snapshot("08:12:00", events.StoppedAt, "1:b"))
+	r.Equal(t, []observed{{events.Arrival, events.SourceStopped, "1:b"}}, kinds(list))
+
+	// 1:b left and 1:c passed between two snapshots.
+	list = tracker.Observe(snapshot("08:25:00", "IN_TRANSIT_TO", "1:d"))
+	r.Equal(t, []observed{
+		{events.Departure, events.SourceStopped, "1:b"},
+		{events.Arrival, events.SourcePassed, "1:c"},
+		{events.Departure, events.SourcePassed, "1:c"},
+	}, kinds(list))
+
+	r.Empty(t, tracker.Observe(snapshot("08:26:00", "IN_TRANSIT_TO", "1:d")))
+	r.Len(t, tracker.Observe(snapshot("08:31:00", events.StoppedAt, "1:d")), 1)
+	r.Empty(t, tracker.Observe(snapshot("08:32:00", events.StoppedAt, "1:d")))
+}
+
+func TestTrackerVanished(t *testing.T) {
+	tracker := events.NewTracker(time.Hour, 5*time.Minute)
+
+	r.Empty(t, tracker.Observe(snapshot("08:25:00", "IN_TRANSIT_TO", "1:d")))
+	r.Empty(t, tracker.Observe(snapshot("08:26:00", "IN_TRANSIT_TO", "1:d")))
+
+	// The train disappeared before reaching its terminus.
+	list := tracker.Observe(api.Holavonat{LastUpdated: serviceDay + 10*3600})
+	r.Equal(t, []observed{{events.Arrival, events.SourceVanished, "1:d"}}, kinds(list))
+	r.Equal(t, serviceDay+8*3600+1800+120, list[0].Observed)
+	r.Equal(t, list[0].Realtime, list[0].Observed)
+	r.Equal(t, int64(120), list[0].ObservedDelay)
+
+	// The vehicle started its next trip instead.
+	r.Empty(t, tracker.Observe(snapshot("11:25:00", "IN_TRANSIT_TO", "1:d")))
+	next := snapshot("11:40:00", events.StoppedAt, "1:a")
+	next.VehiclePositions[0].Trip.GtfsID = "1:t2"
+	list = tracker.Observe(next)
+	r.Equal(t, []observed{{events.Arrival, events.SourceVanished, "1:d"}}, kinds(list))
+	r.Equal(t, "1:t1", list[0].TripID)
+}
+
+func TestServiceDate(t *testing.T) {
+	// The service day of the DST change starts at 23:00 the day before.
+	r.Equal(t, "2025-03-30", events.ServiceDate(time.Date(2025, 3, 29, 23, 0, 0, 0, api.Location).Unix()))
+	r.Equal(t, "2025-03-30", events.ServiceDate(api.ServiceDayStart(time.Date(2025, 3, 30, 10, 0, 0, 0, api.Location)).Unix()))
+}
+
+func TestTrackerVanishAfter(t *testing.T) {
+	tracker := events.NewTracker(time.Hour, 5*time.Minute)
+
+	r.Empty(t, tracker.Observe(snapshot("08:25:00", "IN_TRANSIT_TO", "1:d")))
+	r.Empty(t, tracker.Observe(snapshot("08:26:00", "IN_TRANSIT_TO", "1:d")))
+
+	// A short absence is tolerated, a longer one emits the arrival once.
+	r.Empty(t, tracker.Observe(api.Holavonat{LastUpdated: serviceDay + 8*3600 + 29*60}))
+	list := tracker.Observe(api.Holavonat{LastUpdated: serviceDay + 8*3600 + 32*60})
+	r.Equal(t, []observed{{events.Arrival, events.SourceVanished, "1:d"}}, kinds(list))
+	r.Empty(t, tracker.Observe(api.Holavonat{LastUpdated: serviceDay + 8*3600 + 40*60}))
+}
+
+func TestTrackerLoop(t *testing.T) {
+	tracker := events.NewTracker(time.Hour, 5*time.Minute)
+
+	// The trip ends where it started.
+	loop := func(at, status, stop string) api.Holavonat {
+		data := snapshot(at, status, stop)
+		data.VehiclePositions[0].Trip.Stoptimes[3].Stop.GtfsID = "1:a"
+		return data
+	}
+
+	r.Empty(t, tracker.Observe(loop("08:00:00", events.StoppedAt, "1:a")))
+	r.Len(t, tracker.Observe(loop("08:25:00", "IN_TRANSIT_TO", "1:a")), 5)
+
+	list := tracker.Observe(loop("08:31:00", events.StoppedAt, "1:a"))
+	r.Equal(t, []observed{{events.Arrival, events.SourceStopped, "1:a"}}, kinds(list))
+	r.Equal(t, 3, list[0].StopSequence)
+}
@@ -0,0 +1,28 @@
+package flat
+
+import "github.com/holavonat/holavonatis/internal/events"
+
+type event = events.Event
+
+var EventColumns = []Column[event]{
+	{"service_date", func(e event) any { return e.ServiceDate }},
+	{"kind", func(e event) any { return e.Kind }},
+	{"source", func(e event) any { return e.Source }},
+	{"vehicle_id", func(e event) any { return e.VehicleID }},
+	{"trip_id", func(e event) any { return e.TripID }},
+	{"trip_number", func(e event) any { return e.TripNumber }},
+	{"route", func(e event) any { return e.Route }},
+	{"stop_id", func(e event) any { return e.StopID }},
+	{"stop_name", func(e event) any { return e.StopName }},
+	{"stop_sequence", func(e event) any { return e.StopSequence }},
+	{"observed", func(e event) any { return e.Observed }},
+	{"realtime", func(e event) any { return e.Realtime }},
+	{"scheduled", func(e event) any { return e.Scheduled }},
+	{"delay", func(e event) any { return e.Delay }},
+	{"observed_delay", func(e event) any { return e.ObservedDelay }},
+}
+
+// NewEvents selects every event column.
+func NewEvents() *Table[event] {
+	return &Table[event]{columns: EventColumns}
+}
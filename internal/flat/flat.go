@@ -0,0 +1,126 @@
+package flat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+const (
+	ContentTypeCSV    = "text/csv"
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// Column is a named value of a row.
+type Column[T any] struct {
+	Name  string
+	Value func(T) any
+}
+
+// Table writes rows of T as CSV or NDJSON with the selected columns.
+type Table[T any] struct {
+	columns []Column[T]
+}
+
+// NewTable selects the named columns in the given order.
+func NewTable[T any](available []Column[T], names []string) (*Table[T], error) {
+	table := &Table[T]{}
+	for _, name := range names {
+		i := -1
+		for j, column := range available {
+			if column.Name == name {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownColumn, name)
+		}
+		table.columns = append(table.columns, available[i])
+	}
+	return table, nil
+}
+
+func (t *Table[T]) Header() []string {
+	header := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		header[i] = column.Name
+	}
+	return header
+}
+
+// CSVHeader is the header line of CSV.
+func (t *Table[T]) CSVHeader() []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(t.Header())
+	w.Flush()
+	return buf.Bytes()
+}
+
+// CSV returns the rows without the header line.
+func (t *Table[T]) CSV(rows []T) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record := make([]string, len(t.columns))
+	for _, row := range rows {
+		for i, column := range t.columns {
+			record[i] = format(column.Value(row))
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// NDJSON returns one object per line, the keys in column order.
+func (t *Table[T]) NDJSON(rows []T) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, row := range rows {
+		buf.WriteByte('{')
+		for i, column := range t.columns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(column.Name)
+			value, err := json.Marshal(column.Value(row))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func format(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
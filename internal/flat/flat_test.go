@@ -0,0 +1,36 @@
+package flat_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/columnar"
+	"github.com/holavonat/holavonatis/internal/flat"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestPositions(t *testing.T) {
+	rows := []columnar.PositionRow{
+		{VehicleID: "v1", TripNumber: "2612", Route: "S70", Lat: 47.5, Lon: 19.04, Speed: 12.5, NextStopName: "Budapest-Nyugati, Budapest", Delay: 120, LastUpdated: time.Unix(0, 0)},
+		{VehicleID: "v2", Route: "IC", LastUpdated: time.Unix(1751364000, 0), Cancelled: true},
+	}
+
+	table, err := flat.NewPositions(nil)
+	r.NoError(t, err)
+	r.Equal(t, flat.DefaultPositionColumns, table.Header())
+
+	raw, err := table.CSV(rows)
+	r.NoError(t, err)
+	r.Equal(t, "vehicle_id,trip_number,route,lat,lon,speed,heading,next_stop,delay\n", string(table.CSVHeader()))
+	r.Equal(t, "v1,2612,S70,47.5,19.04,12.5,0,\"Budapest-Nyugati, Budapest\",120\nv2,,IC,0,0,0,0,,0\n", string(raw))
+
+	table, err = flat.NewPositions([]string{"route", "vehicle_id", "last_updated", "cancelled"})
+	r.NoError(t, err)
+	raw, err = table.NDJSON(rows)
+	r.NoError(t, err)
+	r.Equal(t, `{"route":"S70","vehicle_id":"v1","last_updated":0,"cancelled":false}`+"\n"+
+		`{"route":"IC","vehicle_id":"v2","last_updated":1751364000,"cancelled":true}`+"\n", string(raw))
+
+	_, err = flat.NewPositions([]string{"vehicle_id", "color"})
+	r.ErrorIs(t, err, flat.ErrUnknownColumn)
+}
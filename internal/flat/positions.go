@@ -0,0 +1,42 @@
+package flat
+
+import (
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/columnar"
+)
+
+type position = columnar.PositionRow
+
+// DefaultPositionColumns is used when no columns are configured.
+var DefaultPositionColumns = []string{"vehicle_id", "trip_number", "route", "lat", "lon", "speed", "heading", "next_stop", "delay"}
+
+var PositionColumns = []Column[position]{
+	{"snapshot_time", func(p position) any { return p.SnapshotTime.UTC().Format(time.RFC3339) }},
+	{"vehicle_id", func(p position) any { return p.VehicleID }},
+	{"label", func(p position) any { return p.Label }},
+	{"trip_id", func(p position) any { return p.TripID }},
+	{"trip_number", func(p position) any { return p.TripNumber }},
+	{"trip_short_name", func(p position) any { return p.TripShortName }},
+	{"route", func(p position) any { return p.Route }},
+	{"mode", func(p position) any { return p.Mode }},
+	{"headsign", func(p position) any { return p.Headsign }},
+	{"lat", func(p position) any { return p.Lat }},
+	{"lon", func(p position) any { return p.Lon }},
+	{"speed", func(p position) any { return p.Speed }},
+	{"heading", func(p position) any { return p.Heading }},
+	{"last_updated", func(p position) any { return p.LastUpdated.Unix() }},
+	{"stop_status", func(p position) any { return p.StopStatus }},
+	{"next_stop", func(p position) any { return p.NextStopName }},
+	{"next_stop_id", func(p position) any { return p.NextStopID }},
+	{"delay", func(p position) any { return p.Delay }},
+	{"cancelled", func(p position) any { return p.Cancelled }},
+}
+
+// NewPositions selects the position columns, the default ones when empty.
+func NewPositions(names []string) (*Table[position], error) {
+	if len(names) == 0 {
+		names = DefaultPositionColumns
+	}
+	return NewTable(PositionColumns, names)
+}
@@ -0,0 +1,27 @@
+package flat
+
+import (
+	"fmt"
+
+	"github.com/holavonat/holavonatis/internal/punctuality"
+)
+
+type stats = punctuality.Stats
+
+// NewPunctuality has a punctual_N column for every threshold.
+func NewPunctuality() *Table[stats] {
+	columns := []Column[stats]{
+		{"group", func(s stats) any { return s.Group }},
+		{"key", func(s stats) any { return s.Key }},
+		{"name", func(s stats) any { return s.Name }},
+		{"count", func(s stats) any { return s.Count }},
+	}
+	for i, threshold := range punctuality.Thresholds {
+		columns = append(columns, Column[stats]{fmt.Sprintf("punctual_%d", threshold), func(s stats) any { return s.Punctual[i] }})
+	}
+	columns = append(columns,
+		Column[stats]{"mean_delay", func(s stats) any { return s.MeanDelay }},
+		Column[stats]{"p95_delay", func(s stats) any { return s.P95Delay }},
+	)
+	return &Table[stats]{columns: columns}
+}
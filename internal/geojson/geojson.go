@@ -0,0 +1,140 @@
+package geojson
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+const ContentType = "application/geo+json"
+
+const (
+	KindVehicle = "vehicle"
+	KindTrip    = "trip"
+)
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id,omitempty"`
+	Geometry   Geometry `json:"geometry"`
+	Properties any      `json:"properties"`
+}
+
+// Geometry is a Point or a LineString, coordinates are [lon, lat].
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+type VehicleProperties struct {
+	Kind        string  `json:"kind"`
+	VehicleID   string  `json:"vehicleId"`
+	Label       string  `json:"label,omitempty"`
+	TripID      string  `json:"tripId,omitempty"`
+	TripNumber  string  `json:"tripNumber,omitempty"`
+	Route       string  `json:"route,omitempty"`
+	Mode        string  `json:"mode,omitempty"`
+	Headsign    string  `json:"headsign,omitempty"`
+	Delay       int64   `json:"delay"`
+	Speed       float64 `json:"speed"`
+	Heading     float64 `json:"heading"`
+	LastUpdated int     `json:"lastUpdated,omitempty"`
+	Cancelled   bool    `json:"cancelled,omitempty"`
+}
+
+type TripProperties struct {
+	Kind       string `json:"kind"`
+	TripID     string `json:"tripId"`
+	TripNumber string `json:"tripNumber,omitempty"`
+	Route      string `json:"route,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Headsign   string `json:"headsign,omitempty"`
+	Color      string `json:"color,omitempty"`
+	Length     int    `json:"length,omitempty"`
+}
+
+func Encode(data api.Holavonat) ([]byte, error) {
+	return json.Marshal(Features(data))
+}
+
+// Features returns a Point for every vehicle and a LineString for every trip
+// with a valid geometry, a trip shared by several vehicles is drawn once.
+func Features(data api.Holavonat) FeatureCollection {
+	collection := FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]Feature, 0, 2*len(data.VehiclePositions)),
+	}
+
+	trips := make(map[string]bool)
+	for _, vehicle := range data.VehiclePositions {
+		trip := vehicle.Trip
+		collection.Features = append(collection.Features, Feature{
+			Type: "Feature",
+			ID:   vehicle.VehicleID,
+			Geometry: Geometry{
+				Type:        "Point",
+				Coordinates: [2]float64{vehicle.Lon, vehicle.Lat},
+			},
+			Properties: VehicleProperties{
+				Kind:        KindVehicle,
+				VehicleID:   vehicle.VehicleID,
+				Label:       vehicle.Label,
+				TripID:      trip.GtfsID,
+				TripNumber:  trip.TripNumber,
+				Route:       trip.Route.ShortName,
+				Mode:        trip.Route.Mode,
+				Headsign:    trip.TripHeadsign,
+				Delay:       vehicle.Delay(time.Unix(int64(vehicle.LastUpdated), 0)),
+				Speed:       vehicle.Speed,
+				Heading:     vehicle.Heading,
+				LastUpdated: vehicle.LastUpdated,
+				Cancelled:   trip.Cancelled,
+			},
+		})
+
+		if trip.TripGeometry.Points == "" || trips[trip.GtfsID] {
+			continue
+		}
+		points, err := api.DecodePolyline(trip.TripGeometry.Points)
+		if err != nil || len(points) < 2 {
+			continue
+		}
+		trips[trip.GtfsID] = true
+
+		coordinates := make([][2]float64, len(points))
+		for i, point := range points {
+			coordinates[i] = [2]float64{point[1], point[0]}
+		}
+
+		var color string
+		if trip.Route.Color != "" {
+			color = "#" + trip.Route.Color
+		}
+		collection.Features = append(collection.Features, Feature{
+			Type: "Feature",
+			ID:   trip.GtfsID,
+			Geometry: Geometry{
+				Type:        "LineString",
+				Coordinates: coordinates,
+			},
+			Properties: TripProperties{
+				Kind:       KindTrip,
+				TripID:     trip.GtfsID,
+				TripNumber: trip.TripNumber,
+				Route:      trip.Route.ShortName,
+				Mode:       trip.Route.Mode,
+				Headsign:   trip.TripHeadsign,
+				Color:      color,
+				Length:     trip.TripGeometry.Length,
+			},
+		})
+	}
+
+	return collection
+}
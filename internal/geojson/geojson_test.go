@@ -0,0 +1,52 @@
+package geojson_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/geojson"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestFeatures(t *testing.T) {
+	trip := api.Trip{
+		GtfsID:       "1:t1",
+		TripNumber:   "2612",
+		Route:        api.Route{Mode: "RAIL", ShortName: "S70", Color: "0078C8"},
+		TripGeometry: api.TripGeometry{Points: api.EncodePolyline([][2]float64{{47.5, 19.04}, {47.6, 19.1}}), Length: 2},
+		Stoptimes: []api.Stoptimes{
+			{ServiceDay: 1751320800, RealtimeArrival: 36000, ArrivalDelay: 60},
+			{ServiceDay: 1751320800, RealtimeArrival: 39600, ArrivalDelay: 180},
+		},
+	}
+	data := api.Holavonat{VehiclePositions: []api.VehiclePositions{
+		{VehicleID: "v1", Lat: 47.55, Lon: 19.07, Speed: 20, Heading: 90, LastUpdated: 1751320800 + 37000, Trip: trip},
+		{VehicleID: "v2", Lat: 47.58, Lon: 19.09, Trip: trip},
+		{VehicleID: "v3", Lat: 46.2, Lon: 20.1, Trip: api.Trip{GtfsID: "1:t2", TripGeometry: api.TripGeometry{Points: "_p~iF~ps|"}}},
+	}}
+
+	collection := geojson.Features(data)
+	r.Len(t, collection.Features, 4)
+
+	vehicle := collection.Features[0]
+	r.Equal(t, [2]float64{19.07, 47.55}, vehicle.Geometry.Coordinates)
+	properties := vehicle.Properties.(geojson.VehicleProperties)
+	r.Equal(t, int64(180), properties.Delay)
+	r.Equal(t, "S70", properties.Route)
+
+	line := collection.Features[1]
+	r.Equal(t, "LineString", line.Geometry.Type)
+	r.Equal(t, [][2]float64{{19.04, 47.5}, {19.1, 47.6}}, line.Geometry.Coordinates)
+	r.Equal(t, "#0078C8", line.Properties.(geojson.TripProperties).Color)
+
+	// The shared trip is drawn once and the invalid geometry is skipped.
+	r.Equal(t, "v2", collection.Features[2].ID)
+	r.Equal(t, "v3", collection.Features[3].ID)
+
+	raw, err := geojson.Encode(data)
+	r.NoError(t, err)
+	var decoded map[string]any
+	r.NoError(t, json.Unmarshal(raw, &decoded))
+	r.Equal(t, "FeatureCollection", decoded["type"])
+}
@@ -0,0 +1,278 @@
+package gtfsrt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/holavonat/holavonatis/internal/api"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	Version     = "2.0"
+	ContentType = "application/x-protobuf"
+	Language    = "hu"
+)
+
+type Feeds struct {
+	VehiclePositions []byte
+	TripUpdates      []byte
+	Alerts           []byte
+}
+
+func Encode(data api.Holavonat) (Feeds, error) {
+	var feeds Feeds
+	var err error
+
+	feeds.VehiclePositions, err = proto.Marshal(VehiclePositions(data))
+	if err != nil {
+		return Feeds{}, fmt.Errorf("failed to marshal vehicle positions: %w", err)
+	}
+
+	feeds.TripUpdates, err = proto.Marshal(TripUpdates(data))
+	if err != nil {
+		return Feeds{}, fmt.Errorf("failed to marshal trip updates: %w", err)
+	}
+
+	feeds.Alerts, err = proto.Marshal(Alerts(data))
+	if err != nil {
+		return Feeds{}, fmt.Errorf("failed to marshal alerts: %w", err)
+	}
+
+	return feeds, nil
+}
+
+func header(data api.Holavonat) *gtfs.FeedHeader {
+	return &gtfs.FeedHeader{
+		GtfsRealtimeVersion: proto.String(Version),
+		Incrementality:      gtfs.FeedHeader_FULL_DATASET.Enum(),
+		Timestamp:           proto.Uint64(uint64(data.LastUpdated)),
+	}
+}
+
+// staticID strips the feed prefix of an OTP gtfsId ("1:005512393_mh"),
+// leaving the trip_id or stop_id of the static GTFS.
+func staticID(gtfsID string) string {
+	if _, id, ok := strings.Cut(gtfsID, ":"); ok {
+		return id
+	}
+	return gtfsID
+}
+
+// startDate is the service date of the trip, which tells the runs of an
+// overnight trip apart.
+func startDate(trip api.Trip) string {
+	if len(trip.Stoptimes) == 0 || trip.Stoptimes[0].ServiceDay <= 0 {
+		return ""
+	}
+	// The service day starts at noon minus 12 hours, not always at midnight.
+	return time.Unix(trip.Stoptimes[0].ServiceDay+12*3600, 0).In(api.Location).Format("20060102")
+}
+
+func tripDescriptor(trip api.Trip) *gtfs.TripDescriptor {
+	if trip.GtfsID == "" {
+		return nil
+	}
+	descriptor := &gtfs.TripDescriptor{
+		TripId: proto.String(staticID(trip.GtfsID)),
+	}
+	if date := startDate(trip); date != "" {
+		descriptor.StartDate = proto.String(date)
+	}
+	return descriptor
+}
+
+func VehiclePositions(data api.Holavonat) *gtfs.FeedMessage {
+	feed := &gtfs.FeedMessage{
+		Header: header(data),
+	}
+
+	for _, vehicle := range data.VehiclePositions {
+		if vehicle.VehicleID == "" {
+			continue
+		}
+
+		label := vehicle.Label
+		if label == "" {
+			label = vehicle.Trip.TripShortName
+		}
+
+		position := &gtfs.VehiclePosition{
+			Trip: tripDescriptor(vehicle.Trip),
+			Vehicle: &gtfs.VehicleDescriptor{
+				Id:    proto.String(vehicle.VehicleID),
+				Label: proto.String(label),
+			},
+			Position: &gtfs.Position{
+				Latitude:  proto.Float32(float32(vehicle.Lat)),
+				Longitude: proto.Float32(float32(vehicle.Lon)),
+				Bearing:   proto.Float32(float32(vehicle.Heading)),
+				Speed:     proto.Float32(float32(vehicle.Speed)),
+			},
+		}
+
+		if vehicle.LastUpdated > 0 {
+			position.Timestamp = proto.Uint64(uint64(vehicle.LastUpdated))
+		}
+
+		if status, ok := gtfs.VehiclePosition_VehicleStopStatus_value[vehicle.StopRelationship.Status]; ok {
+			position.CurrentStatus = gtfs.VehiclePosition_VehicleStopStatus(status).Enum()
+			if vehicle.StopRelationship.Stop.GtfsID != "" {
+				position.StopId = proto.String(staticID(vehicle.StopRelationship.Stop.GtfsID))
+			}
+		}
+
+		feed.Entity = append(feed.Entity, &gtfs.FeedEntity{
+			Id:      proto.String(vehicle.VehicleID),
+			Vehicle: position,
+		})
+	}
+
+	return feed
+}
+
+func stopTimeEvent(serviceDay, realtime, delay int64) *gtfs.TripUpdate_StopTimeEvent {
+	event := &gtfs.TripUpdate_StopTimeEvent{
+		Delay: proto.Int32(int32(delay)),
+	}
+	if serviceDay > 0 {
+		event.Time = proto.Int64(serviceDay + realtime)
+	}
+	return event
+}
+
+func TripUpdates(data api.Holavonat) *gtfs.FeedMessage {
+	feed := &gtfs.FeedMessage{
+		Header: header(data),
+	}
+
+	seen := make(map[string]bool)
+	for _, vehicle := range data.VehiclePositions {
+		trip := vehicle.Trip
+		id := trip.GtfsID
+		if date := startDate(trip); date != "" {
+			id += "_" + date
+		}
+		if trip.GtfsID == "" || seen[id] || len(trip.Stoptimes) == 0 {
+			continue
+		}
+		seen[id] = true
+
+		update := &gtfs.TripUpdate{
+			Trip: tripDescriptor(trip),
+		}
+		if vehicle.VehicleID != "" {
+			update.Vehicle = &gtfs.VehicleDescriptor{
+				Id: proto.String(vehicle.VehicleID),
+			}
+		}
+		if vehicle.LastUpdated > 0 {
+			update.Timestamp = proto.Uint64(uint64(vehicle.LastUpdated))
+		}
+
+		// An update needs a stop_id or the stop_sequence of the static feed,
+		// the ones with neither are skipped, and so is a trip without any.
+		for _, stoptime := range trip.Stoptimes {
+			if stoptime.Stop.GtfsID == "" && stoptime.StopPosition == nil {
+				continue
+			}
+			stu := &gtfs.TripUpdate_StopTimeUpdate{
+				Arrival:   stopTimeEvent(stoptime.ServiceDay, stoptime.RealtimeArrival, stoptime.ArrivalDelay),
+				Departure: stopTimeEvent(stoptime.ServiceDay, stoptime.RealtimeDeparture, stoptime.DepartureDelay),
+			}
+			if stoptime.Stop.GtfsID != "" {
+				stu.StopId = proto.String(staticID(stoptime.Stop.GtfsID))
+			}
+			if stoptime.StopPosition != nil {
+				stu.StopSequence = proto.Uint32(uint32(*stoptime.StopPosition))
+			}
+			update.StopTimeUpdate = append(update.StopTimeUpdate, stu)
+		}
+		if len(update.StopTimeUpdate) == 0 {
+			continue
+		}
+
+		feed.Entity = append(feed.Entity, &gtfs.FeedEntity{
+			Id:         proto.String(id),
+			TripUpdate: update,
+		})
+	}
+
+	return feed
+}
+
+func translated(text string) *gtfs.TranslatedString {
+	if text == "" {
+		return nil
+	}
+	return &gtfs.TranslatedString{
+		Translation: []*gtfs.TranslatedString_Translation{
+			{
+				Text:     proto.String(text),
+				Language: proto.String(Language),
+			},
+		},
+	}
+}
+
+func Alerts(data api.Holavonat) *gtfs.FeedMessage {
+	feed := &gtfs.FeedMessage{
+		Header: header(data),
+	}
+
+	alerts := make(map[string]*gtfs.Alert)
+	for _, vehicle := range data.VehiclePositions {
+		for _, alert := range vehicle.Trip.Alerts {
+			if alert.ID == "" {
+				continue
+			}
+
+			if existing, ok := alerts[alert.ID]; ok {
+				if trip := tripDescriptor(vehicle.Trip); trip != nil {
+					existing.InformedEntity = append(existing.InformedEntity, &gtfs.EntitySelector{Trip: trip})
+				}
+				continue
+			}
+
+			message := &gtfs.Alert{
+				HeaderText:      translated(alert.AlertHeaderText),
+				DescriptionText: translated(alert.AlertDescriptionText),
+			}
+			if url, ok := alert.AlertURL.(string); ok {
+				message.Url = translated(url)
+			}
+			if cause, ok := gtfs.Alert_Cause_value[alert.AlertCause]; ok {
+				message.Cause = gtfs.Alert_Cause(cause).Enum()
+			}
+			if effect, ok := gtfs.Alert_Effect_value[alert.AlertEffect]; ok {
+				message.Effect = gtfs.Alert_Effect(effect).Enum()
+			}
+			if severity, ok := gtfs.Alert_SeverityLevel_value[alert.AlertSeverityLevel]; ok {
+				message.SeverityLevel = gtfs.Alert_SeverityLevel(severity).Enum()
+			}
+			if alert.EffectiveStartDate > 0 || alert.EffectiveEndDate > 0 {
+				period := &gtfs.TimeRange{}
+				if alert.EffectiveStartDate > 0 {
+					period.Start = proto.Uint64(uint64(alert.EffectiveStartDate))
+				}
+				if alert.EffectiveEndDate > 0 {
+					period.End = proto.Uint64(uint64(alert.EffectiveEndDate))
+				}
+				message.ActivePeriod = []*gtfs.TimeRange{period}
+			}
+			if trip := tripDescriptor(vehicle.Trip); trip != nil {
+				message.InformedEntity = []*gtfs.EntitySelector{{Trip: trip}}
+			}
+
+			alerts[alert.ID] = message
+			feed.Entity = append(feed.Entity, &gtfs.FeedEntity{
+				Id:    proto.String(alert.ID),
+				Alert: message,
+			})
+		}
+	}
+
+	return feed
+}
@@ -0,0 +1,88 @@
+package gtfsrt_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/gtfsrt"
+	r "github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncodeSample(t *testing.T) {
+	raw, err := os.ReadFile("../../docs/sample.json")
+	r.NoError(t, err)
+
+	var response api.OTPResponse
+	r.NoError(t, json.Unmarshal(raw, &response))
+
+	data := api.Holavonat{
+		VehiclePositions: response.Data.VehiclePositions,
+		LastUpdated:      1751402400,
+	}
+
+	feeds, err := gtfsrt.Encode(data)
+	r.NoError(t, err)
+
+	var positions gtfs.FeedMessage
+	r.NoError(t, proto.Unmarshal(feeds.VehiclePositions, &positions))
+	r.Equal(t, gtfsrt.Version, positions.GetHeader().GetGtfsRealtimeVersion())
+	r.Equal(t, uint64(1751402400), positions.GetHeader().GetTimestamp())
+	r.NotEmpty(t, positions.GetEntity())
+
+	first := data.VehiclePositions[0]
+	entity := positions.GetEntity()[0]
+	r.Equal(t, first.VehicleID, entity.GetId())
+	r.InDelta(t, first.Lat, entity.GetVehicle().GetPosition().GetLatitude(), 1e-4)
+	_, tripID, _ := strings.Cut(first.Trip.GtfsID, ":")
+	r.Equal(t, tripID, entity.GetVehicle().GetTrip().GetTripId())
+
+	// The stops of the sample have neither a gtfsId nor a stopPosition.
+	var updates gtfs.FeedMessage
+	r.NoError(t, proto.Unmarshal(feeds.TripUpdates, &updates))
+	r.Empty(t, updates.GetEntity())
+
+	var alerts gtfs.FeedMessage
+	r.NoError(t, proto.Unmarshal(feeds.Alerts, &alerts))
+	for _, entity := range alerts.GetEntity() {
+		r.NotNil(t, entity.GetAlert())
+	}
+}
+
+func TestTripUpdates(t *testing.T) {
+	serviceDay := time.Date(2025, 7, 1, 0, 0, 0, 0, api.Location).Unix()
+	position := 30
+	data := api.Holavonat{
+		LastUpdated: serviceDay + 23*3600,
+		VehiclePositions: []api.VehiclePositions{{
+			VehicleID: "v1",
+			Trip: api.Trip{
+				GtfsID: "1:005512393_mh",
+				Stoptimes: []api.Stoptimes{
+					{Stop: api.Stop{GtfsID: "1:005510009"}, ServiceDay: serviceDay, RealtimeArrival: 23 * 3600},
+					{ServiceDay: serviceDay, RealtimeArrival: 24 * 3600},
+					{Stop: api.Stop{GtfsID: "1:005517228"}, StopPosition: &position, ServiceDay: serviceDay, RealtimeArrival: 25 * 3600},
+				},
+			},
+		}},
+	}
+
+	update := gtfsrt.TripUpdates(data).GetEntity()[0].GetTripUpdate()
+	r.Equal(t, "005512393_mh", update.GetTrip().GetTripId())
+	r.Equal(t, "20250701", update.GetTrip().GetStartDate())
+	r.Len(t, update.GetStopTimeUpdate(), 2)
+	r.Equal(t, "005510009", update.GetStopTimeUpdate()[0].GetStopId())
+	r.Zero(t, update.GetStopTimeUpdate()[0].GetStopSequence())
+	r.Equal(t, uint32(30), update.GetStopTimeUpdate()[1].GetStopSequence())
+	r.Equal(t, serviceDay+25*3600, update.GetStopTimeUpdate()[1].GetArrival().GetTime())
+
+	// Without stops the trip has no updates at all.
+	data.VehiclePositions[0].Trip.Stoptimes[0].Stop.GtfsID = ""
+	data.VehiclePositions[0].Trip.Stoptimes[2] = api.Stoptimes{ServiceDay: serviceDay}
+	r.Empty(t, gtfsrt.TripUpdates(data).GetEntity())
+}
@@ -0,0 +1,102 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	log "github.com/holavonat/holavonatis/internal/logger"
+)
+
+// ServeTrips serves GET /api/history/trips/{number}?date=YYYY-MM-DD, the
+// date defaults to today in Budapest.
+func (s *Store) ServeTrips(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().In(api.Location).Format(time.DateOnly)
+	} else if _, err := time.Parse(time.DateOnly, date); err != nil {
+		http.Error(w, "invalid date", http.StatusBadRequest)
+		return
+	}
+
+	trips, err := s.Trips(r.Context(), r.PathValue("number"), date)
+	respond(w, trips, err)
+}
+
+// ServeStation serves GET /api/history/stations/{stop}?from=&to=, the
+// window defaults to the hour before and after now.
+func (s *Store) ServeStation(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	from, to, err := window(r, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	calls, err := s.Station(r.Context(), r.PathValue("stop"), from, to)
+	respond(w, calls, err)
+}
+
+// ServeTrail serves GET /api/history/vehicles/{vehicle}/trail?from=&to=, the
+// window defaults to the last hour.
+func (s *Store) ServeTrail(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	from, to, err := window(r, now.Add(-time.Hour), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	positions, err := s.Trail(r.Context(), r.PathValue("vehicle"), from, to)
+	respond(w, positions, err)
+}
+
+func respond(w http.ResponseWriter, result any, err error) {
+	if err != nil {
+		log.New("history").Errorw("Failed to query history", "error", err)
+		http.Error(w, "failed to query history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(result)
+}
+
+// MaxWindow is the longest from-to window a request may ask for.
+const MaxWindow = 24 * time.Hour
+
+// window parses the from and to query parameters as RFC 3339 times or Unix
+// seconds, and rejects windows that end before they start or are longer
+// than MaxWindow.
+func window(r *http.Request, from, to time.Time) (time.Time, time.Time, error) {
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = parseTime(value); err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = parseTime(value); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("to is before from")
+	}
+	if to.Sub(from) > MaxWindow {
+		return from, to, fmt.Errorf("window is longer than %s", MaxWindow)
+	}
+	return from, to, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
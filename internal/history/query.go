@@ -0,0 +1,204 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Position struct {
+	SnapshotTime int64   `json:"snapshotTime"`
+	VehicleID    string  `json:"vehicleId"`
+	TripID       string  `json:"tripId"`
+	ServiceDate  string  `json:"serviceDate"`
+	Lat          float64 `json:"lat"`
+	Lon          float64 `json:"lon"`
+	Speed        float64 `json:"speed"`
+	Heading      float64 `json:"heading"`
+	LastUpdated  int64   `json:"lastUpdated"`
+	Delay        int64   `json:"delay"`
+	StopStatus   string  `json:"stopStatus,omitempty"`
+	StopID       string  `json:"stopId,omitempty"`
+}
+
+type Stoptime struct {
+	StopSequence       int    `json:"stopSequence"`
+	StopID             string `json:"stopId"`
+	StopName           string `json:"stopName"`
+	ScheduledArrival   int64  `json:"scheduledArrival"`
+	ScheduledDeparture int64  `json:"scheduledDeparture"`
+	RealtimeArrival    int64  `json:"realtimeArrival"`
+	RealtimeDeparture  int64  `json:"realtimeDeparture"`
+	ArrivalDelay       int64  `json:"arrivalDelay"`
+	DepartureDelay     int64  `json:"departureDelay"`
+}
+
+type Alert struct {
+	ID          string `json:"id"`
+	Header      string `json:"header"`
+	Description string `json:"description"`
+	Effect      string `json:"effect"`
+	Severity    string `json:"severity"`
+}
+
+type Trip struct {
+	TripID        string     `json:"tripId"`
+	ServiceDate   string     `json:"serviceDate"`
+	TripNumber    string     `json:"tripNumber"`
+	TripShortName string     `json:"tripShortName"`
+	Route         string     `json:"route"`
+	Mode          string     `json:"mode"`
+	Headsign      string     `json:"headsign"`
+	Category      string     `json:"category"`
+	VehicleID     string     `json:"vehicleId"`
+	Cancelled     bool       `json:"cancelled"`
+	FirstSeen     int64      `json:"firstSeen"`
+	LastSeen      int64      `json:"lastSeen"`
+	Stoptimes     []Stoptime `json:"stoptimes"`
+	Alerts        []Alert    `json:"alerts"`
+	Trail         []Position `json:"trail"`
+}
+
+// Call is a trip at a stop.
+type Call struct {
+	TripID      string `json:"tripId"`
+	ServiceDate string `json:"serviceDate"`
+	TripNumber  string `json:"tripNumber"`
+	Route       string `json:"route"`
+	Headsign    string `json:"headsign"`
+	Stoptime
+}
+
+const positionColumns = `snapshot_time, vehicle_id, trip_id, service_date, lat, lon, speed, heading, last_updated, delay, stop_status, stop_id`
+
+func scanPositions(rows *sql.Rows, err error) ([]Position, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []Position{}
+	for rows.Next() {
+		var p Position
+		if err := rows.Scan(&p.SnapshotTime, &p.VehicleID, &p.TripID, &p.ServiceDate, &p.Lat, &p.Lon, &p.Speed,
+			&p.Heading, &p.LastUpdated, &p.Delay, &p.StopStatus, &p.StopID); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+// Trail returns the first Limit positions of a vehicle between from and to.
+func (s *Store) Trail(ctx context.Context, vehicleID string, from, to time.Time) ([]Position, error) {
+	return scanPositions(s.db.QueryContext(ctx, `SELECT `+positionColumns+` FROM positions
+		WHERE vehicle_id = ? AND snapshot_time BETWEEN ? AND ? ORDER BY snapshot_time LIMIT ?`, vehicleID, from.Unix(), to.Unix(), s.Limit))
+}
+
+// Trips returns the trips with the trip number on the service date, with
+// their last observed stoptimes, their alerts and their trail.
+func (s *Store) Trips(ctx context.Context, number, date string) ([]Trip, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT trip_id, service_date, trip_number, trip_short_name, route, mode,
+		headsign, category, vehicle_id, cancelled, first_seen, last_seen
+		FROM trips WHERE trip_number = ? AND service_date = ? ORDER BY first_seen LIMIT ?`, number, date, s.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := []Trip{}
+	for rows.Next() {
+		var t Trip
+		if err := rows.Scan(&t.TripID, &t.ServiceDate, &t.TripNumber, &t.TripShortName, &t.Route, &t.Mode,
+			&t.Headsign, &t.Category, &t.VehicleID, &t.Cancelled, &t.FirstSeen, &t.LastSeen); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		trips = append(trips, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range trips {
+		t := &trips[i]
+		if t.Stoptimes, err = s.stoptimes(ctx, t.TripID, t.ServiceDate); err != nil {
+			return nil, err
+		}
+		if t.Alerts, err = s.alerts(ctx, t.TripID, t.ServiceDate); err != nil {
+			return nil, err
+		}
+		if t.Trail, err = scanPositions(s.db.QueryContext(ctx, `SELECT `+positionColumns+` FROM positions
+			WHERE trip_id = ? AND service_date = ? ORDER BY snapshot_time LIMIT ?`, t.TripID, t.ServiceDate, s.Limit)); err != nil {
+			return nil, err
+		}
+	}
+	return trips, nil
+}
+
+func (s *Store) stoptimes(ctx context.Context, tripID, date string) ([]Stoptime, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT stop_sequence, stop_id, stop_name, scheduled_arrival, scheduled_departure,
+		realtime_arrival, realtime_departure, arrival_delay, departure_delay
+		FROM stoptimes WHERE trip_id = ? AND service_date = ? ORDER BY stop_sequence`, tripID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stoptimes := []Stoptime{}
+	for rows.Next() {
+		var st Stoptime
+		if err := rows.Scan(&st.StopSequence, &st.StopID, &st.StopName, &st.ScheduledArrival, &st.ScheduledDeparture,
+			&st.RealtimeArrival, &st.RealtimeDeparture, &st.ArrivalDelay, &st.DepartureDelay); err != nil {
+			return nil, err
+		}
+		stoptimes = append(stoptimes, st)
+	}
+	return stoptimes, rows.Err()
+}
+
+func (s *Store) alerts(ctx context.Context, tripID, date string) ([]Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT a.id, a.header, a.description, a.effect, a.severity
+		FROM trip_alerts t JOIN alerts a ON a.id = t.alert_id
+		WHERE t.trip_id = ? AND t.service_date = ? ORDER BY a.first_seen`, tripID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.Header, &a.Description, &a.Effect, &a.Severity); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// Station returns the first Limit trips scheduled to arrive at the stop
+// between from and to.
+func (s *Store) Station(ctx context.Context, stopID string, from, to time.Time) ([]Call, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT s.trip_id, s.service_date, t.trip_number, t.route, t.headsign,
+		s.stop_sequence, s.stop_id, s.stop_name, s.scheduled_arrival, s.scheduled_departure,
+		s.realtime_arrival, s.realtime_departure, s.arrival_delay, s.departure_delay
+		FROM stoptimes s JOIN trips t ON t.trip_id = s.trip_id AND t.service_date = s.service_date
+		WHERE s.stop_id = ? AND s.scheduled_arrival BETWEEN ? AND ? ORDER BY s.scheduled_arrival LIMIT ?`, stopID, from.Unix(), to.Unix(), s.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calls := []Call{}
+	for rows.Next() {
+		var c Call
+		if err := rows.Scan(&c.TripID, &c.ServiceDate, &c.TripNumber, &c.Route, &c.Headsign,
+			&c.StopSequence, &c.StopID, &c.StopName, &c.ScheduledArrival, &c.ScheduledDeparture,
+			&c.RealtimeArrival, &c.RealtimeDeparture, &c.ArrivalDelay, &c.DepartureDelay); err != nil {
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	return calls, rows.Err()
+}
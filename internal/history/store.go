@@ -0,0 +1,232 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/events"
+	_ "modernc.org/sqlite"
+)
+
+// Times are Unix seconds, service dates are YYYY-MM-DD in Budapest. The
+// positions keep every cycle, trips, stoptimes and alerts the last observed
+// state.
+const schema = `
+CREATE TABLE IF NOT EXISTS positions (
+	snapshot_time INTEGER NOT NULL,
+	vehicle_id    TEXT NOT NULL,
+	trip_id       TEXT NOT NULL,
+	service_date  TEXT NOT NULL,
+	lat           REAL NOT NULL,
+	lon           REAL NOT NULL,
+	speed         REAL NOT NULL,
+	heading       REAL NOT NULL,
+	last_updated  INTEGER NOT NULL,
+	delay         INTEGER NOT NULL,
+	stop_status   TEXT NOT NULL,
+	stop_id       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS positions_vehicle ON positions (vehicle_id, snapshot_time);
+CREATE INDEX IF NOT EXISTS positions_trip ON positions (trip_id, service_date, snapshot_time);
+CREATE INDEX IF NOT EXISTS positions_time ON positions (snapshot_time);
+
+CREATE TABLE IF NOT EXISTS trips (
+	trip_id         TEXT NOT NULL,
+	service_date    TEXT NOT NULL,
+	trip_number     TEXT NOT NULL,
+	trip_short_name TEXT NOT NULL,
+	route           TEXT NOT NULL,
+	mode            TEXT NOT NULL,
+	headsign        TEXT NOT NULL,
+	category        TEXT NOT NULL,
+	vehicle_id      TEXT NOT NULL,
+	cancelled       INTEGER NOT NULL,
+	first_seen      INTEGER NOT NULL,
+	last_seen       INTEGER NOT NULL,
+	PRIMARY KEY (trip_id, service_date)
+);
+CREATE INDEX IF NOT EXISTS trips_number ON trips (trip_number, service_date);
+CREATE INDEX IF NOT EXISTS trips_last_seen ON trips (last_seen);
+
+CREATE TABLE IF NOT EXISTS stoptimes (
+	trip_id             TEXT NOT NULL,
+	service_date        TEXT NOT NULL,
+	stop_sequence       INTEGER NOT NULL,
+	stop_id             TEXT NOT NULL,
+	stop_name           TEXT NOT NULL,
+	scheduled_arrival   INTEGER NOT NULL,
+	scheduled_departure INTEGER NOT NULL,
+	realtime_arrival    INTEGER NOT NULL,
+	realtime_departure  INTEGER NOT NULL,
+	arrival_delay       INTEGER NOT NULL,
+	departure_delay     INTEGER NOT NULL,
+	updated             INTEGER NOT NULL,
+	PRIMARY KEY (trip_id, service_date, stop_sequence)
+);
+CREATE INDEX IF NOT EXISTS stoptimes_stop ON stoptimes (stop_id, scheduled_arrival);
+
+CREATE TABLE IF NOT EXISTS alerts (
+	id          TEXT PRIMARY KEY,
+	feed        TEXT NOT NULL,
+	header      TEXT NOT NULL,
+	description TEXT NOT NULL,
+	cause       TEXT NOT NULL,
+	effect      TEXT NOT NULL,
+	severity    TEXT NOT NULL,
+	valid_from  INTEGER NOT NULL,
+	valid_until INTEGER NOT NULL,
+	first_seen  INTEGER NOT NULL,
+	last_seen   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS trip_alerts (
+	trip_id      TEXT NOT NULL,
+	service_date TEXT NOT NULL,
+	alert_id     TEXT NOT NULL,
+	PRIMARY KEY (trip_id, service_date, alert_id)
+);
+`
+
+// DefaultLimit caps the rows a query returns.
+const DefaultLimit = 10000
+
+type Store struct {
+	// Limit is the maximum number of trips, calls or positions a query
+	// returns, DefaultLimit after Open.
+	Limit int
+	db    *sql.DB
+}
+
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, err
+	}
+	// One writer, the queries of the API wait for the busy timeout.
+	db.SetMaxOpenConns(4)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+	return &Store{Limit: DefaultLimit, db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Write stores one snapshot in a single transaction.
+func (s *Store) Write(ctx context.Context, data api.Holavonat) error {
+	at := data.LastUpdated
+	if at == 0 {
+		at = time.Now().Unix()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	position, err := tx.PrepareContext(ctx, `INSERT INTO positions VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	trip, err := tx.PrepareContext(ctx, `INSERT INTO trips VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (trip_id, service_date) DO UPDATE SET
+			vehicle_id = excluded.vehicle_id, cancelled = excluded.cancelled, last_seen = excluded.last_seen`)
+	if err != nil {
+		return err
+	}
+	stoptime, err := tx.PrepareContext(ctx, `INSERT INTO stoptimes VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (trip_id, service_date, stop_sequence) DO UPDATE SET
+			realtime_arrival = excluded.realtime_arrival, realtime_departure = excluded.realtime_departure,
+			arrival_delay = excluded.arrival_delay, departure_delay = excluded.departure_delay, updated = excluded.updated`)
+	if err != nil {
+		return err
+	}
+	alert, err := tx.PrepareContext(ctx, `INSERT INTO alerts VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			header = excluded.header, description = excluded.description, valid_until = excluded.valid_until, last_seen = excluded.last_seen`)
+	if err != nil {
+		return err
+	}
+	tripAlert, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO trip_alerts VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range data.VehiclePositions {
+		t := v.Trip
+		date := serviceDate(v, at)
+		now := time.Unix(int64(v.LastUpdated), 0)
+		if v.LastUpdated == 0 {
+			now = time.Unix(at, 0)
+		}
+
+		if _, err := position.ExecContext(ctx, at, v.VehicleID, t.GtfsID, date, v.Lat, v.Lon, v.Speed, v.Heading,
+			v.LastUpdated, v.Delay(now), v.StopRelationship.Status, v.StopRelationship.Stop.GtfsID); err != nil {
+			return err
+		}
+
+		if t.GtfsID == "" {
+			continue
+		}
+		if _, err := trip.ExecContext(ctx, t.GtfsID, date, t.TripNumber, t.TripShortName, t.Route.ShortName, t.Route.Mode,
+			t.TripHeadsign, t.TrainCategoryID, v.VehicleID, t.Cancelled, at, at); err != nil {
+			return err
+		}
+		for i, st := range t.Stoptimes {
+			if _, err := stoptime.ExecContext(ctx, t.GtfsID, date, i, st.Stop.GtfsID, st.Stop.Name,
+				st.ServiceDay+st.ScheduledArrival, st.ServiceDay+st.ScheduledDeparture,
+				st.ServiceDay+st.RealtimeArrival, st.ServiceDay+st.RealtimeDeparture,
+				st.ArrivalDelay, st.DepartureDelay, at); err != nil {
+				return err
+			}
+		}
+		for _, a := range t.Alerts {
+			id := a.ID
+			if a.AlertHash != 0 {
+				id = fmt.Sprint(a.AlertHash)
+			}
+			if _, err := alert.ExecContext(ctx, id, a.Feed, a.AlertHeaderText, a.AlertDescriptionText, a.AlertCause,
+				a.AlertEffect, a.AlertSeverityLevel, a.EffectiveStartDate, a.EffectiveEndDate, at, at); err != nil {
+				return err
+			}
+			if _, err := tripAlert.ExecContext(ctx, t.GtfsID, date, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Prune deletes the positions before cutoff and the trips, stoptimes and
+// alerts last seen before it.
+func (s *Store) Prune(ctx context.Context, cutoff time.Time) error {
+	before := cutoff.Unix()
+	for _, query := range []string{
+		`DELETE FROM positions WHERE snapshot_time < ?`,
+		`DELETE FROM stoptimes WHERE (trip_id, service_date) IN (SELECT trip_id, service_date FROM trips WHERE last_seen < ?)`,
+		`DELETE FROM trip_alerts WHERE (trip_id, service_date) IN (SELECT trip_id, service_date FROM trips WHERE last_seen < ?)`,
+		`DELETE FROM trips WHERE last_seen < ?`,
+		`DELETE FROM alerts WHERE last_seen < ?`,
+	} {
+		if _, err := s.db.ExecContext(ctx, query, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serviceDate(v api.VehiclePositions, at int64) string {
+	if len(v.Trip.Stoptimes) > 0 {
+		return events.ServiceDate(v.Trip.Stoptimes[0].ServiceDay)
+	}
+	return time.Unix(at, 0).In(api.Location).Format(time.DateOnly)
+}
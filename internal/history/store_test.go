@@ -0,0 +1,148 @@
+package history_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/history"
+	r "github.com/stretchr/testify/require"
+)
+
+var serviceDay = time.Date(2025, 7, 1, 0, 0, 0, 0, api.Location).Unix()
+
+func snapshot(at int64, lat float64, delay int64) api.Holavonat {
+	return api.Holavonat{
+		LastUpdated: at,
+		VehiclePositions: []api.VehiclePositions{{
+			VehicleID:   "v1",
+			Lat:         lat,
+			Lon:         19,
+			LastUpdated: int(at),
+			Trip: api.Trip{
+				GtfsID:       "1:t1",
+				TripNumber:   "2612",
+				TripHeadsign: "Szeged",
+				Route:        api.Route{ShortName: "IC", Mode: "RAIL"},
+				Alerts:       []api.Alerts{{ID: "a1", AlertHeaderText: "Works", AlertHash: 42}},
+				Stoptimes: []api.Stoptimes{
+					{
+						Stop:              api.Stop{GtfsID: "1:nyugati", Name: "Nyugati"},
+						ServiceDay:        serviceDay,
+						ScheduledArrival:  8 * 3600,
+						RealtimeArrival:   8 * 3600,
+						RealtimeDeparture: 8*3600 + 60,
+					},
+					{
+						Stop:             api.Stop{GtfsID: "1:szeged", Name: "Szeged"},
+						ServiceDay:       serviceDay,
+						ScheduledArrival: 10 * 3600,
+						RealtimeArrival:  10*3600 + delay,
+						ArrivalDelay:     delay,
+					},
+				},
+			},
+		}},
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	r.NoError(t, err)
+	defer store.Close()
+
+	at := serviceDay + 8*3600 + 600
+	r.NoError(t, store.Write(ctx, snapshot(at, 47.5, 60)))
+	r.NoError(t, store.Write(ctx, snapshot(at+60, 47.4, 120)))
+
+	trips, err := store.Trips(ctx, "2612", "2025-07-01")
+	r.NoError(t, err)
+	r.Len(t, trips, 1)
+	r.Equal(t, "Szeged", trips[0].Headsign)
+	r.Equal(t, at, trips[0].FirstSeen)
+	r.Equal(t, at+60, trips[0].LastSeen)
+	r.Len(t, trips[0].Stoptimes, 2)
+	r.Equal(t, int64(120), trips[0].Stoptimes[1].ArrivalDelay)
+	r.Equal(t, serviceDay+10*3600+120, trips[0].Stoptimes[1].RealtimeArrival)
+	r.Len(t, trips[0].Alerts, 1)
+	r.Equal(t, "42", trips[0].Alerts[0].ID)
+	r.Len(t, trips[0].Trail, 2)
+	r.Equal(t, 47.4, trips[0].Trail[1].Lat)
+
+	calls, err := store.Station(ctx, "1:szeged", time.Unix(serviceDay+9*3600, 0), time.Unix(serviceDay+11*3600, 0))
+	r.NoError(t, err)
+	r.Len(t, calls, 1)
+	r.Equal(t, "2612", calls[0].TripNumber)
+
+	trail, err := store.Trail(ctx, "v1", time.Unix(at+30, 0), time.Unix(at+120, 0))
+	r.NoError(t, err)
+	r.Len(t, trail, 1)
+
+	store.Limit = 1
+	trail, err = store.Trail(ctx, "v1", time.Unix(at, 0), time.Unix(at+120, 0))
+	r.NoError(t, err)
+	r.Len(t, trail, 1)
+	r.Equal(t, at, trail[0].SnapshotTime)
+	trips, err = store.Trips(ctx, "2612", "2025-07-01")
+	r.NoError(t, err)
+	r.Len(t, trips[0].Trail, 1)
+	store.Limit = history.DefaultLimit
+
+	r.NoError(t, store.Prune(ctx, time.Unix(at+30, 0)))
+	trips, err = store.Trips(ctx, "2612", "2025-07-01")
+	r.NoError(t, err)
+	r.Len(t, trips, 1)
+	r.Len(t, trips[0].Trail, 1)
+
+	r.NoError(t, store.Prune(ctx, time.Unix(at+120, 0)))
+	trips, err = store.Trips(ctx, "2612", "2025-07-01")
+	r.NoError(t, err)
+	r.Empty(t, trips)
+}
+
+func TestServe(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	r.NoError(t, err)
+	defer store.Close()
+
+	at := serviceDay + 8*3600 + 600
+	r.NoError(t, store.Write(context.Background(), snapshot(at, 47.5, 60)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/history/trips/{number}", store.ServeTrips)
+	mux.HandleFunc("GET /api/history/vehicles/{vehicle}/trail", store.ServeTrail)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/trips/2612?date=2025-07-01", nil))
+	r.Equal(t, http.StatusOK, w.Code)
+	var trips []history.Trip
+	r.NoError(t, json.Unmarshal(w.Body.Bytes(), &trips))
+	r.Len(t, trips, 1)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/vehicles/v1/trail?from=2025-07-01T08:00:00%2B02:00&to="+time.Unix(at, 0).Format(time.RFC3339), nil))
+	r.Equal(t, http.StatusOK, w.Code)
+	var trail []history.Position
+	r.NoError(t, json.Unmarshal(w.Body.Bytes(), &trail))
+	r.Len(t, trail, 1)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/trips/2612?date=yesterday", nil))
+	r.Equal(t, http.StatusBadRequest, w.Code)
+
+	for _, query := range []string{
+		fmt.Sprintf("from=%d&to=%d", at, at-1),
+		fmt.Sprintf("from=%d&to=%d", at, at+25*3600),
+	} {
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/vehicles/v1/trail?"+query, nil))
+		r.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
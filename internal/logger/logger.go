@@ -151,7 +151,8 @@ func checkFilePathValid(fp string) error {
 }
 
 type logger struct {
-	zapLogger *zap.Logger
+	zapLogger  *zap.Logger
+	lumberjack *lumberjack.Logger
 }
 
 func newLogger(config Config) *logger {
@@ -166,7 +167,7 @@ func newLogger(config Config) *logger {
 		if err != nil {
 			panic(err)
 		}
-		logger := logger{zapLogger}
+		logger := logger{zapLogger: zapLogger}
 		return &logger
 	}
 
@@ -175,7 +176,7 @@ func newLogger(config Config) *logger {
 		panic(err)
 	}
 
-	logger := logger{zapLogger}
+	logger := logger{zapLogger: zapLogger, lumberjack: zapParsedConf.lumberjack}
 	return &logger
 
 }
@@ -195,7 +196,7 @@ func zapCore(lj *lumberjack.Logger) func(c zapcore.Core) zapcore.Core {
 }
 
 func (l *logger) New(name string) Logger {
-	newLogger := logger{l.zapLogger.Named(name)}
+	newLogger := logger{zapLogger: l.zapLogger.Named(name)}
 	return &newLogger
 }
 
@@ -72,3 +72,13 @@ func Fatalw(msg string, args ...interface{}) {
 func New(name string) Logger {
 	return root.New(name)
 }
+
+// Sync flushes the buffered log entries and closes the log file.
+func Sync() error {
+	// Syncing stdout fails on some platforms (EINVAL), that is not worth reporting.
+	root.zapLogger.Sync()
+	if root.lumberjack != nil {
+		return root.lumberjack.Close()
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace       = "holavonatis"
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Duration of the upstream GraphQL requests by HTTP status code (\"error\" when no response was received).",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"code"})
+
+	Vehicles = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vehicles",
+		Help:      "Number of vehicles in the last fetched snapshot by mode.",
+	}, []string{"mode"})
+
+	PayloadBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "payload_bytes",
+		Help:      "Size of the published payloads by compression (\"none\" is the raw payload).",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"compression"})
+
+	UploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_duration_seconds",
+		Help:      "Duration of the uploads by sink.",
+		Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"sink"})
+
+	UploadErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_errors_total",
+		Help:      "Number of failed uploads by sink.",
+	}, []string{"sink"})
+
+	LastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful fetch/upload cycle.",
+	})
+
+	Interval = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "interval_seconds",
+		Help:      "Sleep chosen before the next scheduled cycle.",
+	})
+)
+
+var (
+	started     = time.Now()
+	lastSuccess atomic.Int64
+)
+
+// ObserveFetch records an upstream request, code is 0 when no response was received.
+func ObserveFetch(code int, duration time.Duration) {
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+	}
+	FetchDuration.WithLabelValues(label).Observe(duration.Seconds())
+}
+
+// ObserveUpload records an upload to the named sink.
+func ObserveUpload(sink string, duration time.Duration, err error) {
+	UploadDuration.WithLabelValues(sink).Observe(duration.Seconds())
+	if err != nil {
+		UploadErrors.WithLabelValues(sink).Inc()
+	}
+}
+
+// ObservePayload records the size of a published payload, encoding is empty
+// for the raw one.
+func ObservePayload(encoding string, size int) {
+	if encoding == "" {
+		encoding = "none"
+	}
+	PayloadBytes.WithLabelValues(encoding).Observe(float64(size))
+}
+
+// Recorder records the upstream requests of an api.Client and the uploads
+// of an output.Publisher in the default registry.
+type Recorder struct{}
+
+func (Recorder) ObserveFetch(code int, duration time.Duration) {
+	ObserveFetch(code, duration)
+}
+
+func (Recorder) ObservePayload(encoding string, size int) {
+	ObservePayload(encoding, size)
+}
+
+func (Recorder) ObserveUpload(sink string, duration time.Duration, err error) {
+	ObserveUpload(sink, duration, err)
+}
+
+// ObserveVehicles replaces the vehicle counts, modes missing from counts are reset.
+func ObserveVehicles(counts map[string]int) {
+	Vehicles.Reset()
+	for mode, count := range counts {
+		Vehicles.WithLabelValues(mode).Set(float64(count))
+	}
+}
+
+func Succeeded(t time.Time) {
+	lastSuccess.Store(t.Unix())
+	LastSuccess.Set(float64(t.Unix()))
+}
+
+// Healthz fails when the last successful cycle (or the start, before the
+// first one) is older than maxAge.
+func Healthz(maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		last := started
+		if unix := lastSuccess.Load(); unix != 0 {
+			last = time.Unix(unix, 0)
+		}
+
+		age := time.Since(last).Truncate(time.Second)
+		if maxAge > 0 && age > maxAge {
+			http.Error(w, fmt.Sprintf("stale: last success %s ago", age), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintf(w, "ok: last success %s ago\n", age)
+	}
+}
+
+// ListenAndServe serves /metrics and /healthz until ctx is done.
+func ListenAndServe(ctx context.Context, addr string, maxAge time.Duration) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /healthz", Healthz(maxAge))
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,46 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestHealthz(t *testing.T) {
+	healthz := metrics.Healthz(time.Minute)
+
+	rec := httptest.NewRecorder()
+	healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	r.Equal(t, http.StatusOK, rec.Code)
+
+	metrics.Succeeded(time.Now().Add(-2 * time.Minute))
+	rec = httptest.NewRecorder()
+	healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	r.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	metrics.Succeeded(time.Now())
+	rec = httptest.NewRecorder()
+	healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	r.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestObserve(t *testing.T) {
+	metrics.ObserveUpload("file", time.Millisecond, nil)
+	metrics.ObserveUpload("file", time.Millisecond, http.ErrHandlerTimeout)
+	r.Equal(t, 1.0, testutil.ToFloat64(metrics.UploadErrors.WithLabelValues("file")))
+
+	metrics.Recorder{}.ObserveUpload("r2", time.Millisecond, http.ErrHandlerTimeout)
+	r.Equal(t, 1.0, testutil.ToFloat64(metrics.UploadErrors.WithLabelValues("r2")))
+	metrics.Recorder{}.ObservePayload("", 2048)
+	r.Equal(t, 1, testutil.CollectAndCount(metrics.PayloadBytes))
+
+	metrics.ObserveVehicles(map[string]int{"RAIL": 3, "TRAM": 1})
+	metrics.ObserveVehicles(map[string]int{"RAIL": 2})
+	r.Equal(t, 2.0, testutil.ToFloat64(metrics.Vehicles.WithLabelValues("RAIL")))
+	r.Equal(t, 1, testutil.CollectAndCount(metrics.Vehicles))
+}
@@ -0,0 +1,182 @@
+package normalized
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+const Version = "v4"
+
+// Stoptime references its stop by gtfsId.
+type Stoptime struct {
+	api.Stoptimes
+	Stop string `json:"stop,omitempty"`
+}
+
+// Trip references its stops and its geometry by id, the geometry id is the
+// hash of the encoded polyline.
+type Trip struct {
+	api.Trip
+	Stoptimes    []Stoptime `json:"stoptimes,omitempty"`
+	TripGeometry string     `json:"tripGeometry,omitempty"`
+}
+
+type StopRelationship struct {
+	Status string `json:"status,omitempty"`
+	Stop   string `json:"stop,omitempty"`
+}
+
+type Vehicle struct {
+	api.VehiclePositions
+	StopRelationship StopRelationship `json:"stopRelationship,omitempty"`
+	Trip             Trip             `json:"trip"`
+}
+
+// Versions are the content hashes of the dictionaries the snapshot refers to.
+type Versions struct {
+	Stops      string `json:"stops"`
+	Geometries string `json:"geometries"`
+}
+
+// Dictionaries holds the changed dictionaries, an unchanged one is nil.
+type Dictionaries struct {
+	Versions   Versions
+	Stops      map[string]api.Stop
+	Geometries map[string]api.TripGeometry
+}
+
+type Snapshot struct {
+	Source           api.Source        `json:"source"`
+	Timestamp        string            `json:"timestamp"`
+	VehiclePositions []Vehicle         `json:"vehiclePositions"`
+	LastUpdated      int64             `json:"lastUpdated"`
+	Errors           api.GraphQLErrors `json:"errors,omitempty"`
+	MissingAreas     []api.BBox        `json:"missingAreas,omitempty"`
+	Dictionaries     Versions          `json:"dictionaries"`
+	// Stops and Geometries are only inlined when they changed.
+	Stops      map[string]api.Stop         `json:"stops,omitempty"`
+	Geometries map[string]api.TripGeometry `json:"geometries,omitempty"`
+}
+
+// Encoder collects the stops and geometries seen during a service day, so
+// the dictionaries only change when something new shows up.
+type Encoder struct {
+	day        string
+	stops      map[string]api.Stop
+	geometries map[string]api.TripGeometry
+	current    Versions
+	sent       Versions
+}
+
+// Encode normalizes data and returns the dictionaries that changed since the
+// previous call, nil when none did.
+func (e *Encoder) Encode(data api.Holavonat) (Snapshot, *Dictionaries) {
+	day := time.Unix(data.LastUpdated, 0).In(api.Location).Format("20060102")
+	if day != e.day || e.stops == nil {
+		e.day = day
+		e.stops = make(map[string]api.Stop)
+		e.geometries = make(map[string]api.TripGeometry)
+		e.current = Versions{}
+	}
+
+	var stopsChanged, geometriesChanged bool
+	vehicles := make([]Vehicle, 0, len(data.VehiclePositions))
+	for _, vehicle := range data.VehiclePositions {
+		v := Vehicle{
+			VehiclePositions: vehicle,
+			StopRelationship: StopRelationship{
+				Status: vehicle.StopRelationship.Status,
+				Stop:   vehicle.StopRelationship.Stop.GtfsID,
+			},
+			Trip: Trip{Trip: vehicle.Trip},
+		}
+		v.VehiclePositions.StopRelationship = api.StopRelationship{}
+		v.VehiclePositions.Trip = api.Trip{}
+		v.Trip.Trip.Stoptimes = nil
+		v.Trip.Trip.TripGeometry = api.TripGeometry{}
+
+		for _, stoptime := range vehicle.Trip.Stoptimes {
+			stop := stoptime.Stop
+			if _, ok := e.stops[stop.GtfsID]; stop.GtfsID != "" && !ok {
+				e.stops[stop.GtfsID] = stop
+				stopsChanged = true
+			}
+			stoptime.Stop = api.Stop{}
+			v.Trip.Stoptimes = append(v.Trip.Stoptimes, Stoptime{Stoptimes: stoptime, Stop: stop.GtfsID})
+		}
+
+		// The relationship only carries the name, the stoptimes win.
+		if stop := vehicle.StopRelationship.Stop; stop.GtfsID != "" {
+			if _, ok := e.stops[stop.GtfsID]; !ok {
+				e.stops[stop.GtfsID] = stop
+				stopsChanged = true
+			}
+		}
+
+		if geometry := vehicle.Trip.TripGeometry; geometry.Points != "" {
+			id := hash(geometry.Points)
+			if _, ok := e.geometries[id]; !ok {
+				e.geometries[id] = geometry
+				geometriesChanged = true
+			}
+			v.Trip.TripGeometry = id
+		}
+
+		vehicles = append(vehicles, v)
+	}
+
+	if stopsChanged || e.current.Stops == "" {
+		e.current.Stops = version(e.stops)
+	}
+	if geometriesChanged || e.current.Geometries == "" {
+		e.current.Geometries = version(e.geometries)
+	}
+
+	snapshot := Snapshot{
+		Source:           data.Source,
+		Timestamp:        data.Timestamp,
+		VehiclePositions: vehicles,
+		LastUpdated:      data.LastUpdated,
+		Errors:           data.Errors,
+		MissingAreas:     data.MissingAreas,
+		Dictionaries:     e.current,
+	}
+
+	if e.current == e.sent {
+		return snapshot, nil
+	}
+
+	dictionaries := &Dictionaries{Versions: e.current}
+	if e.current.Stops != e.sent.Stops {
+		dictionaries.Stops = e.stops
+	}
+	if e.current.Geometries != e.sent.Geometries {
+		dictionaries.Geometries = e.geometries
+	}
+	e.sent = e.current
+
+	return snapshot, dictionaries
+}
+
+// Reset makes the next Encode return both dictionaries again, e.g. after
+// publishing them failed.
+func (e *Encoder) Reset() {
+	e.sent = Versions{}
+}
+
+func version(dictionary any) string {
+	raw, err := json.Marshal(dictionary)
+	if err != nil {
+		return ""
+	}
+	return hash(string(raw))
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
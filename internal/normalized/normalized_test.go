@@ -0,0 +1,84 @@
+package normalized_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/normalized"
+	r "github.com/stretchr/testify/require"
+)
+
+func snapshot(lastUpdated time.Time, stops ...string) api.Holavonat {
+	var stoptimes []api.Stoptimes
+	for _, stop := range stops {
+		stoptimes = append(stoptimes, api.Stoptimes{
+			Stop:             api.Stop{GtfsID: stop, Name: "Stop " + stop, Lat: 47.5, Lon: 19.04},
+			ScheduledArrival: 3600,
+		})
+	}
+
+	return api.Holavonat{
+		LastUpdated: lastUpdated.Unix(),
+		VehiclePositions: []api.VehiclePositions{{
+			VehicleID: "v1",
+			StopRelationship: api.StopRelationship{
+				Status: "IN_TRANSIT_TO",
+				Stop:   api.Stop{GtfsID: stops[0], Name: "Stop " + stops[0]},
+			},
+			Trip: api.Trip{
+				GtfsID:       "1:t1",
+				Stoptimes:    stoptimes,
+				TripGeometry: api.TripGeometry{Points: "_p~iF~ps|U_ulLnnqC", Length: 3},
+			},
+		}},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var encoder normalized.Encoder
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, api.Location)
+
+	first, dictionaries := encoder.Encode(snapshot(now, "1:a", "1:b"))
+	r.NotNil(t, dictionaries)
+	r.Len(t, dictionaries.Stops, 2)
+	r.Len(t, dictionaries.Geometries, 1)
+	r.Equal(t, first.Dictionaries, dictionaries.Versions)
+
+	vehicle := first.VehiclePositions[0]
+	r.Equal(t, "1:a", vehicle.StopRelationship.Stop)
+	r.Equal(t, "1:b", vehicle.Trip.Stoptimes[1].Stop)
+	r.Equal(t, "1:t1", vehicle.Trip.GtfsID)
+	r.Contains(t, dictionaries.Geometries, vehicle.Trip.TripGeometry)
+	r.Equal(t, 47.5, dictionaries.Stops["1:a"].Lat)
+
+	raw, err := json.Marshal(first)
+	r.NoError(t, err)
+	r.Contains(t, string(raw), `"stop":"1:a"`)
+	r.NotContains(t, string(raw), "Stop 1:a")
+	r.NotContains(t, string(raw), "_p~iF")
+
+	// Nothing new, the dictionaries are not sent again.
+	second, dictionaries := encoder.Encode(snapshot(now.Add(time.Minute), "1:b", "1:a"))
+	r.Nil(t, dictionaries)
+	r.Equal(t, first.Dictionaries, second.Dictionaries)
+
+	third, dictionaries := encoder.Encode(snapshot(now.Add(2*time.Minute), "1:a", "1:c"))
+	r.NotNil(t, dictionaries)
+	r.Len(t, dictionaries.Stops, 3)
+	r.Nil(t, dictionaries.Geometries)
+	r.NotEqual(t, first.Dictionaries.Stops, third.Dictionaries.Stops)
+	r.Equal(t, first.Dictionaries.Geometries, third.Dictionaries.Geometries)
+
+	encoder.Reset()
+	_, dictionaries = encoder.Encode(snapshot(now.Add(3*time.Minute), "1:a"))
+	r.NotNil(t, dictionaries)
+	r.Len(t, dictionaries.Stops, 3)
+	r.Len(t, dictionaries.Geometries, 1)
+
+	// A new service day starts with empty dictionaries.
+	_, dictionaries = encoder.Encode(snapshot(now.Add(24*time.Hour), "1:a"))
+	r.NotNil(t, dictionaries)
+	r.Len(t, dictionaries.Stops, 1)
+}
@@ -0,0 +1,93 @@
+package output
+
+import (
+	"fmt"
+
+	"github.com/D3vl0per/crypt/compression"
+)
+
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+)
+
+// Compress returns the payload compressed with the given algorithm at its
+// best level and the matching Content-Encoding. An empty or "none" algorithm
+// returns raw as is.
+func Compress(raw []byte, algorithm string) ([]byte, string, error) {
+	return compress(raw, algorithm, true)
+}
+
+// CompressDefault is Compress with the default (faster) levels.
+func CompressDefault(raw []byte, algorithm string) ([]byte, string, error) {
+	return compress(raw, algorithm, false)
+}
+
+func compress(raw []byte, algorithm string, best bool) ([]byte, string, error) {
+	switch algorithm {
+	case EncodingBrotli:
+		brotli := compression.Brotli{
+			Level: compression.BrotliDefaultCompression,
+		}
+		if best {
+			brotli.Level = compression.BrotliBestCompression
+		}
+		payload, err := brotli.Compress(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return payload, EncodingBrotli, nil
+
+	case EncodingGzip:
+		gzip := compression.Gzip{
+			Level: compression.DefaultCompression,
+		}
+		if best {
+			gzip.Level = compression.BestCompression
+		}
+		payload, err := gzip.Compress(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return payload, EncodingGzip, nil
+
+	case EncodingZstd:
+		zstd := compression.Zstd{
+			Level: compression.ZstdSpeedDefault,
+		}
+		if best {
+			zstd.Level = compression.ZstdSpeedBestCompression
+		}
+		payload, err := zstd.Compress(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return payload, EncodingZstd, nil
+
+	case "", "none":
+		return raw, "", nil
+
+	default:
+		return nil, "", fmt.Errorf("unsupported compression: %s", algorithm)
+	}
+}
+
+// Decompress reverses Compress for the given Content-Encoding.
+func Decompress(payload []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingBrotli:
+		brotli := compression.Brotli{}
+		return brotli.Decompress(payload)
+	case EncodingGzip:
+		gzip := compression.Gzip{}
+		return gzip.Decompress(payload)
+	case EncodingZstd:
+		zstd := compression.Zstd{}
+		return zstd.Decompress(payload)
+	case "", "identity":
+		return payload, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
@@ -0,0 +1,224 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var encodingSuffix = map[string]string{
+	EncodingBrotli: ".br",
+	EncodingGzip:   ".gz",
+	EncodingZstd:   ".zst",
+}
+
+// Filesystem stores objects below Path. Compressed objects get the usual
+// precompressed suffix (.br, .gz, .zst) so static file servers can pick them up.
+// Metadata is not persisted.
+type Filesystem struct {
+	Path string
+}
+
+func NewFilesystem(path string) (*Filesystem, error) {
+	if path == "" {
+		return nil, errors.New("missing file output path")
+	}
+
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(path, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create folder: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check folder: %w", err)
+	}
+
+	return &Filesystem{Path: path}, nil
+}
+
+func (f *Filesystem) path(name string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(name))
+	if clean == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid object name: %q", name)
+	}
+	return filepath.Join(f.Path, clean), nil
+}
+
+func (f *Filesystem) Put(ctx context.Context, object Object, data []byte) (ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	name := object.Name + encodingSuffix[object.ContentEncoding]
+	path, err := f.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	// Write to a temporary file first, readers never see a half written snapshot.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return ObjectInfo{}, err
+	}
+
+	return f.Stat(ctx, name)
+}
+
+// Append writes data to the end of the object, creating it when missing. The
+// data is never compressed, the object stays readable while it grows.
+func (f *Filesystem) Append(ctx context.Context, object Object, data []byte) (ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	path, err := f.path(object.Name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return ObjectInfo{}, err
+	}
+	if err := file.Close(); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return f.Stat(ctx, object.Name)
+}
+
+func (f *Filesystem) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	path, err := f.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotExist
+	} else if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return fileInfo(name, stat), nil
+}
+
+func (f *Filesystem) Get(ctx context.Context, name string) ([]byte, ObjectInfo, error) {
+	info, err := f.Stat(ctx, name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	path, err := f.path(name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	return data, info, nil
+}
+
+func (f *Filesystem) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(f.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.Path, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileInfo(name, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+
+	return objects, nil
+}
+
+func (f *Filesystem) Delete(ctx context.Context, name string) error {
+	path, err := f.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func fileInfo(name string, stat fs.FileInfo) ObjectInfo {
+	info := ObjectInfo{
+		Name:         name,
+		Size:         stat.Size(),
+		LastModified: stat.ModTime(),
+	}
+
+	info.ContentEncoding = Encoding(name)
+	base := strings.TrimSuffix(name, encodingSuffix[info.ContentEncoding])
+	info.ContentType = mime.TypeByExtension(filepath.Ext(base))
+
+	return info
+}
+
+// Encoding returns the content encoding of a file name by its compression
+// suffix, empty for uncompressed names.
+func Encoding(name string) string {
+	for encoding, suffix := range encodingSuffix {
+		if strings.HasSuffix(name, suffix) {
+			return encoding
+		}
+	}
+	return ""
+}
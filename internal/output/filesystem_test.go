@@ -0,0 +1,166 @@
+package output_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/server"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestFilesystemSink(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(filepath.Join(t.TempDir(), "out"))
+	r.NoError(t, err)
+
+	info, err := fs.Put(ctx, output.Object{Name: "data.json", ContentType: "application/json"}, []byte(`{}`))
+	r.NoError(t, err)
+	r.Equal(t, "data.json", info.Name)
+	r.Equal(t, int64(2), info.Size)
+
+	info, err = fs.Put(ctx, output.Object{Name: "archive/data_1.json", ContentEncoding: output.EncodingGzip}, []byte(`x`))
+	r.NoError(t, err)
+	r.Equal(t, "archive/data_1.json.gz", info.Name)
+	r.Equal(t, output.EncodingGzip, info.ContentEncoding)
+
+	objects, err := fs.List(ctx, "archive/")
+	r.NoError(t, err)
+	r.Len(t, objects, 1)
+	r.Equal(t, "archive/data_1.json.gz", objects[0].Name)
+
+	r.NoError(t, fs.Delete(ctx, "data.json"))
+	_, err = fs.Stat(ctx, "data.json")
+	r.ErrorIs(t, err, output.ErrNotExist)
+
+	_, err = fs.Put(ctx, output.Object{Name: "../escape.json"}, []byte(`{}`))
+	r.NoError(t, err)
+	_, err = os.Stat(filepath.Join(fs.Path, "escape.json"))
+	r.NoError(t, err)
+}
+
+type observer struct {
+	payloads []string
+	uploads  map[string]bool
+}
+
+func (o *observer) ObservePayload(encoding string, size int) {
+	o.payloads = append(o.payloads, encoding)
+}
+
+func (o *observer) ObserveUpload(sink string, duration time.Duration, err error) {
+	o.uploads[sink] = err == nil
+}
+
+func TestPublisherFanout(t *testing.T) {
+	ctx := context.Background()
+	plain, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+	compressed, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+
+	publisher := output.Publisher{
+		Destinations: []output.Destination{
+			{Name: "plain", Sink: plain},
+			{Name: "compressed", Sink: compressed, Compression: output.EncodingZstd},
+			{Name: "broken", Sink: plain, Compression: "lzma"},
+		},
+		Observer: &observer{uploads: make(map[string]bool)},
+	}
+
+	err = publisher.Publish(ctx, output.Object{Name: "data.json"}, []byte(`{"vehiclePositions":[]}`))
+	r.ErrorContains(t, err, "broken")
+
+	_, err = plain.Stat(ctx, "data.json")
+	r.NoError(t, err)
+	_, err = compressed.Stat(ctx, "data.json.zst")
+	r.NoError(t, err)
+
+	observed := publisher.Observer.(*observer)
+	r.Equal(t, []string{"", output.EncodingZstd}, observed.payloads)
+	r.Equal(t, map[string]bool{"plain": true, "compressed": true}, observed.uploads)
+}
+
+func TestPublisherLoad(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+
+	publisher := output.Publisher{
+		Destinations: []output.Destination{{Name: "file", Sink: fs, Compression: output.EncodingBrotli}},
+	}
+
+	_, err = publisher.Load(ctx, "state.json")
+	r.ErrorIs(t, err, output.ErrNotExist)
+
+	r.NoError(t, publisher.Publish(ctx, output.Object{Name: "state.json"}, []byte(`{"sequence":3}`)))
+	data, err := publisher.Load(ctx, "state.json")
+	r.NoError(t, err)
+	r.JSONEq(t, `{"sequence":3}`, string(data))
+}
+
+func TestPublisherAppend(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+
+	publisher := output.Publisher{
+		Destinations: []output.Destination{{Name: "file", Sink: fs, Compression: output.EncodingGzip}},
+	}
+
+	object := output.Object{Name: "daily/positions.csv", ContentType: "text/csv"}
+	r.NoError(t, publisher.Append(ctx, object, []byte("id\n"), []byte("1\n")))
+	r.NoError(t, publisher.Append(ctx, object, []byte("id\n"), []byte("2\n3\n")))
+
+	data, info, err := fs.Get(ctx, "daily/positions.csv")
+	r.NoError(t, err)
+	r.Equal(t, "id\n1\n2\n3\n", string(data))
+	r.Empty(t, info.ContentEncoding)
+}
+
+// partSink hides the Append of the wrapped sink.
+type partSink struct {
+	output.Sink
+	output.Getter
+}
+
+func TestPublisherAppendParts(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+	memory := server.NewMemory()
+
+	publisher := output.Publisher{
+		Destinations: []output.Destination{
+			{Name: "r2", Sink: partSink{Sink: fs, Getter: fs}},
+			{Name: "server", Sink: memory},
+		},
+	}
+
+	object := output.Object{Name: "events.csv", ContentType: "text/csv"}
+	r.NoError(t, publisher.Append(ctx, object, []byte("id\n"), []byte("1\n")))
+
+	parts, err := fs.List(ctx, "events/")
+	r.NoError(t, err)
+	r.Len(t, parts, 1)
+	r.Regexp(t, `^events/part-\d+\.csv$`, parts[0].Name)
+
+	data, err := publisher.Load(ctx, parts[0].Name)
+	r.NoError(t, err)
+	r.Equal(t, "id\n1\n", string(data))
+
+	_, err = publisher.Load(ctx, "events.csv")
+	r.ErrorIs(t, err, output.ErrNotExist)
+	objects, err := memory.List(ctx, "")
+	r.NoError(t, err)
+	r.Empty(t, objects)
+}
+
+func TestPartName(t *testing.T) {
+	at := time.Unix(1704186000, 0)
+	r.Equal(t, "events_2024-01-02/part-1704186000.csv", output.PartName("events_2024-01-02.csv", at))
+	r.Equal(t, "daily/part-1704186000", output.PartName("daily", at))
+}
@@ -0,0 +1,211 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+type Destination struct {
+	Sink        Sink
+	Name        string
+	Compression string
+}
+
+// Publisher fans an object out to every configured destination. A failing
+// destination does not stop the others, the errors are joined.
+type Publisher struct {
+	Destinations []Destination
+	Observer     Observer
+}
+
+// Observer records the payload sizes by encoding, empty for the raw
+// payload, and the uploads by sink.
+type Observer interface {
+	ObservePayload(encoding string, size int)
+	ObserveUpload(sink string, duration time.Duration, err error)
+}
+
+func (p *Publisher) observePayload(encoding string, size int) {
+	if p.Observer != nil {
+		p.Observer.ObservePayload(encoding, size)
+	}
+}
+
+func (p *Publisher) observeUpload(sink string, start time.Time, err error) {
+	if p.Observer != nil {
+		p.Observer.ObserveUpload(sink, time.Since(start), err)
+	}
+}
+
+func (p *Publisher) Publish(ctx context.Context, object Object, raw []byte) error {
+	if len(p.Destinations) == 0 {
+		return nil
+	}
+
+	payloads := make(map[string][]byte)
+	encodings := make(map[string]string)
+
+	p.observePayload("", len(raw))
+
+	var errs []error
+	for _, destination := range p.Destinations {
+		compression := destination.Compression
+		if object.NoCompression {
+			compression = ""
+		}
+
+		payload, ok := payloads[compression]
+		if !ok {
+			var err error
+			payload, encodings[compression], err = Compress(raw, compression)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", destination.Name, err))
+				continue
+			}
+			payloads[compression] = payload
+			if encodings[compression] != "" {
+				p.observePayload(encodings[compression], len(payload))
+			}
+		}
+
+		obj := object
+		obj.ContentEncoding = encodings[compression]
+
+		start := time.Now()
+		_, err := destination.Sink.Put(ctx, obj, payload)
+		p.observeUpload(destination.Name, start, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to put %s: %w", destination.Name, object.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Append adds raw to the object on every destination. A new object starts
+// with header. The sinks that cannot append, such as R2, get a part object
+// instead, see PartName. Parts are archive objects, so the server memory does
+// not keep them.
+func (p *Publisher) Append(ctx context.Context, object Object, header, raw []byte) error {
+	now := time.Now()
+
+	var errs []error
+	for _, destination := range p.Destinations {
+		appender, ok := destination.Sink.(Appender)
+		if !ok {
+			errs = append(errs, p.part(ctx, destination, object, header, raw, now))
+			continue
+		}
+
+		payload := raw
+		if len(header) > 0 {
+			_, err := destination.Sink.Stat(ctx, object.Name)
+			if errors.Is(err, ErrNotExist) {
+				payload = append(append([]byte{}, header...), raw...)
+			} else if err != nil {
+				errs = append(errs, fmt.Errorf("%s: failed to stat %s: %w", destination.Name, object.Name, err))
+				continue
+			}
+		}
+
+		start := time.Now()
+		_, err := appender.Append(ctx, object, payload)
+		p.observeUpload(destination.Name, start, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to append %s: %w", destination.Name, object.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PartName is the name of the part of name written at t by the sinks that
+// cannot append, {name}/part-{unix}{ext}, e.g. events_2024-01-02/part-1704186000.csv.
+func PartName(name string, t time.Time) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s/part-%d%s", strings.TrimSuffix(name, ext), t.Unix(), ext)
+}
+
+// part puts header and raw as a new part of the object, compressed as
+// configured.
+func (p *Publisher) part(ctx context.Context, destination Destination, object Object, header, raw []byte, now time.Time) error {
+	compression := destination.Compression
+	if object.NoCompression {
+		compression = ""
+	}
+	payload, encoding, err := Compress(append(append([]byte{}, header...), raw...), compression)
+	if err != nil {
+		return fmt.Errorf("%s: %w", destination.Name, err)
+	}
+
+	obj := object
+	obj.Name = PartName(object.Name, now)
+	obj.ContentEncoding = encoding
+	obj.Archive = true
+
+	start := time.Now()
+	_, err = destination.Sink.Put(ctx, obj, payload)
+	p.observeUpload(destination.Name, start, err)
+	if err != nil {
+		return fmt.Errorf("%s: failed to put %s: %w", destination.Name, obj.Name, err)
+	}
+	return nil
+}
+
+// Load reads name back from the first destination that supports it and
+// returns it decompressed, ErrNotExist when no destination has it.
+func (p *Publisher) Load(ctx context.Context, name string) ([]byte, error) {
+	for _, destination := range p.Destinations {
+		data, err := p.get(ctx, destination, name)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		}
+		return data, err
+	}
+	return nil, ErrNotExist
+}
+
+// get reads name back from destination decompressed, ErrNotExist when the
+// sink does not have it or cannot read it back.
+func (p *Publisher) get(ctx context.Context, destination Destination, name string) ([]byte, error) {
+	getter, ok := destination.Sink.(Getter)
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	// The filesystem sink stores compressed objects with a suffix.
+	candidates := []string{name}
+	if suffix := encodingSuffix[destination.Compression]; suffix != "" {
+		candidates = append(candidates, name+suffix)
+	}
+	for _, candidate := range candidates {
+		data, info, err := getter.Get(ctx, candidate)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: failed to get %s: %w", destination.Name, name, err)
+		}
+		return Decompress(data, info.ContentEncoding)
+	}
+	return nil, ErrNotExist
+}
+
+// Delete removes name from every destination, missing objects are ignored.
+func (p *Publisher) Delete(ctx context.Context, name string) error {
+	var errs []error
+	for _, destination := range p.Destinations {
+		candidates := []string{name}
+		if suffix := encodingSuffix[destination.Compression]; suffix != "" {
+			candidates = append(candidates, name+suffix)
+		}
+		for _, candidate := range candidates {
+			if err := destination.Sink.Delete(ctx, candidate); err != nil && !errors.Is(err, ErrNotExist) {
+				errs = append(errs, fmt.Errorf("%s: failed to delete %s: %w", destination.Name, candidate, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
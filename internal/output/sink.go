@@ -0,0 +1,56 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotExist = errors.New("object does not exist")
+)
+
+// Sink is a destination for the published objects (latest snapshot, archives).
+type Sink interface {
+	Put(ctx context.Context, object Object, data []byte) (ObjectInfo, error)
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Getter is implemented by sinks that can read stored objects back.
+type Getter interface {
+	Get(ctx context.Context, name string) ([]byte, ObjectInfo, error)
+}
+
+// Appender is implemented by sinks that can grow an object in place.
+type Appender interface {
+	Append(ctx context.Context, object Object, data []byte) (ObjectInfo, error)
+}
+
+// Immutable is the Cache-Control of objects named after their content.
+const Immutable = "public, max-age=31536000, immutable"
+
+type Object struct {
+	Metadata        map[string]string
+	Name            string
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	Archive         bool
+	// NoCompression stores the payload as is, e.g. for formats that are
+	// compressed internally.
+	NoCompression bool
+}
+
+type ObjectInfo struct {
+	LastModified    time.Time         `json:"last_modified"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Name            string            `json:"name"`
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	CacheControl    string            `json:"cache_control,omitempty"`
+	ETag            string            `json:"etag,omitempty"`
+	PublicLink      string            `json:"public_link,omitempty"`
+	Size            int64             `json:"size"`
+}
@@ -0,0 +1,256 @@
+package punctuality
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/events"
+)
+
+const (
+	GroupOverall  = "overall"
+	GroupRoute    = "route"
+	GroupCategory = "category"
+	GroupStation  = "station"
+)
+
+// Thresholds are the punctuality limits in minutes, a stop is punctual at N
+// minutes when its delay is less than N+1 whole minutes.
+var Thresholds = []int{0, 5, 15}
+
+type stop struct {
+	trip  string
+	index int
+}
+
+// record is the last observed state of a trip stop.
+type record struct {
+	Route      string
+	Category   string
+	TripNumber string
+	StopID     string
+	StopName   string
+	Delay      int64
+	Passed     bool
+}
+
+// Aggregator keeps the last observed arrival delay of every trip stop per
+// service date, the departure delay of the origin. Only the stops the train
+// already reached count.
+type Aggregator struct {
+	mu   sync.Mutex
+	days map[string]map[stop]record
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{days: make(map[string]map[stop]record)}
+}
+
+func (a *Aggregator) Observe(data api.Holavonat) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, vehicle := range data.VehiclePositions {
+		now := int64(vehicle.LastUpdated)
+		if now == 0 {
+			now = data.LastUpdated
+		}
+
+		trip := vehicle.Trip
+		for i, stoptime := range trip.Stoptimes {
+			date := events.ServiceDate(stoptime.ServiceDay)
+			day, ok := a.days[date]
+			if !ok {
+				day = make(map[stop]record)
+				a.days[date] = day
+			}
+			// The origin counts by its departure, it has no real arrival.
+			delay, at := stoptime.ArrivalDelay, stoptime.RealtimeArrival
+			if i == 0 {
+				delay, at = stoptime.DepartureDelay, stoptime.RealtimeDeparture
+			}
+			day[stop{trip.GtfsID, i}] = record{
+				Route:      trip.Route.ShortName,
+				Category:   trip.TrainCategoryID,
+				TripNumber: trip.TripNumber,
+				StopID:     stoptime.Stop.GtfsID,
+				StopName:   stoptime.Stop.Name,
+				Delay:      delay,
+				Passed:     stoptime.ServiceDay+at <= now,
+			}
+		}
+	}
+}
+
+// Dates returns the service dates with observations in ascending order.
+func (a *Aggregator) Dates() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dates := make([]string, 0, len(a.days))
+	for date := range a.days {
+		dates = append(dates, date)
+	}
+	slices.Sort(dates)
+	return dates
+}
+
+// Expire drops the service dates before date.
+func (a *Aggregator) Expire(date string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for d := range a.days {
+		if d < date {
+			delete(a.days, d)
+		}
+	}
+}
+
+// Stats summarizes the arrival delays, in seconds, of a group of stops.
+type Stats struct {
+	Group     string    `json:"group"`
+	Key       string    `json:"key"`
+	Name      string    `json:"name,omitempty"`
+	Count     int       `json:"count"`
+	Punctual  []float64 `json:"punctual"`
+	MeanDelay float64   `json:"meanDelay"`
+	P95Delay  int64     `json:"p95Delay"`
+}
+
+// Train is a train by the largest delay at any of its reached stops.
+type Train struct {
+	TripID     string `json:"tripId"`
+	TripNumber string `json:"tripNumber,omitempty"`
+	Route      string `json:"route,omitempty"`
+	StopName   string `json:"stopName,omitempty"`
+	MaxDelay   int64  `json:"maxDelay"`
+}
+
+type Report struct {
+	Date        string  `json:"date"`
+	GeneratedAt string  `json:"generatedAt"`
+	Thresholds  []int   `json:"thresholds"`
+	Overall     Stats   `json:"overall"`
+	Routes      []Stats `json:"routes"`
+	Categories  []Stats `json:"categories"`
+	Stations    []Stats `json:"stations"`
+	WorstTrains []Train `json:"worstTrains"`
+}
+
+// Report summarizes date with the worst trains, at most worst of them.
+func (a *Aggregator) Report(date string, worst int, now time.Time) Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	type group struct {
+		name   string
+		delays []int64
+	}
+	groups := map[string]map[string]*group{
+		GroupRoute:    {},
+		GroupCategory: {},
+		GroupStation:  {},
+	}
+	add := func(kind, key, name string, delay int64) {
+		g, ok := groups[kind][key]
+		if !ok {
+			g = &group{name: name}
+			groups[kind][key] = g
+		}
+		g.delays = append(g.delays, delay)
+	}
+
+	var overall []int64
+	trains := make(map[string]Train)
+	for s, r := range a.days[date] {
+		if !r.Passed {
+			continue
+		}
+		overall = append(overall, r.Delay)
+		add(GroupRoute, r.Route, "", r.Delay)
+		add(GroupCategory, r.Category, "", r.Delay)
+		add(GroupStation, r.StopID, r.StopName, r.Delay)
+
+		if train, ok := trains[s.trip]; !ok || r.Delay > train.MaxDelay {
+			trains[s.trip] = Train{TripID: s.trip, TripNumber: r.TripNumber, Route: r.Route, StopName: r.StopName, MaxDelay: r.Delay}
+		}
+	}
+
+	report := Report{
+		Date:        date,
+		GeneratedAt: now.Format(time.RFC3339),
+		Thresholds:  Thresholds,
+		Overall:     stats(GroupOverall, "", "", overall),
+	}
+
+	list := func(kind string) []Stats {
+		result := make([]Stats, 0, len(groups[kind]))
+		for key, g := range groups[kind] {
+			result = append(result, stats(kind, key, g.name, g.delays))
+		}
+		slices.SortFunc(result, func(a, b Stats) int { return cmp.Compare(a.Key, b.Key) })
+		return result
+	}
+	report.Routes = list(GroupRoute)
+	report.Categories = list(GroupCategory)
+	report.Stations = list(GroupStation)
+
+	report.WorstTrains = make([]Train, 0, len(trains))
+	for _, train := range trains {
+		report.WorstTrains = append(report.WorstTrains, train)
+	}
+	slices.SortFunc(report.WorstTrains, func(a, b Train) int {
+		return cmp.Or(cmp.Compare(b.MaxDelay, a.MaxDelay), cmp.Compare(a.TripID, b.TripID))
+	})
+	report.WorstTrains = report.WorstTrains[:min(worst, len(report.WorstTrains))]
+
+	return report
+}
+
+func stats(kind, key, name string, delays []int64) Stats {
+	s := Stats{
+		Group:    kind,
+		Key:      key,
+		Name:     name,
+		Count:    len(delays),
+		Punctual: make([]float64, len(Thresholds)),
+	}
+	if len(delays) == 0 {
+		return s
+	}
+
+	slices.Sort(delays)
+	var sum int64
+	for _, delay := range delays {
+		sum += delay
+		for i, threshold := range Thresholds {
+			if delay < int64(threshold+1)*60 {
+				s.Punctual[i]++
+			}
+		}
+	}
+	for i := range s.Punctual {
+		s.Punctual[i] = round(s.Punctual[i] / float64(len(delays)))
+	}
+	s.MeanDelay = round(float64(sum) / float64(len(delays)))
+	s.P95Delay = delays[int(math.Ceil(0.95*float64(len(delays))))-1]
+
+	return s
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// Stats returns every group of the report, the overall one first.
+func (r Report) Stats() []Stats {
+	all := []Stats{r.Overall}
+	all = append(all, r.Routes...)
+	all = append(all, r.Categories...)
+	return append(all, r.Stations...)
+}
@@ -0,0 +1,90 @@
+package punctuality_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/punctuality"
+	r "github.com/stretchr/testify/require"
+)
+
+var serviceDay = time.Date(2025, 7, 1, 0, 0, 0, 0, api.Location).Unix()
+
+func vehicle(trip, route, category string, now int64, delays ...int64) api.VehiclePositions {
+	var stoptimes []api.Stoptimes
+	for i, delay := range delays {
+		stoptimes = append(stoptimes, api.Stoptimes{
+			Stop:              api.Stop{GtfsID: fmt.Sprintf("1:%d", i), Name: fmt.Sprintf("Stop %d", i)},
+			ServiceDay:        serviceDay,
+			RealtimeArrival:   int64(8*3600+i*600) + delay,
+			RealtimeDeparture: int64(8*3600+i*600) + delay,
+			ArrivalDelay:      delay,
+			DepartureDelay:    delay,
+		})
+	}
+	return api.VehiclePositions{
+		VehicleID:   trip,
+		LastUpdated: int(now),
+		Trip: api.Trip{
+			GtfsID:          "1:" + trip,
+			TripNumber:      trip,
+			Route:           api.Route{ShortName: route},
+			TrainCategoryID: category,
+			Stoptimes:       stoptimes,
+		},
+	}
+}
+
+func TestReport(t *testing.T) {
+	aggregator := punctuality.NewAggregator()
+	at := serviceDay + 8*3600 + 1500
+
+	// The delay of a reached stop is overwritten by the later observation.
+	aggregator.Observe(api.Holavonat{VehiclePositions: []api.VehiclePositions{
+		vehicle("t1", "S70", "10", at, 0, 600, 0),
+	}})
+	aggregator.Observe(api.Holavonat{VehiclePositions: []api.VehiclePositions{
+		vehicle("t1", "S70", "10", at, 30, 240, 1200),
+		vehicle("t2", "IC", "20", at, 1200, 1200),
+	}})
+
+	r.Equal(t, []string{"2025-07-01"}, aggregator.Dates())
+
+	report := aggregator.Report("2025-07-01", 1, time.Unix(at, 0))
+	// The third stop of t1 and the second of t2 are not reached yet.
+	r.Equal(t, 3, report.Overall.Count)
+	r.Equal(t, []float64{0.333, 0.667, 0.667}, report.Overall.Punctual)
+	r.Equal(t, 490.0, report.Overall.MeanDelay)
+	r.Equal(t, int64(1200), report.Overall.P95Delay)
+
+	r.Len(t, report.Routes, 2)
+	r.Equal(t, "IC", report.Routes[0].Key)
+	r.Equal(t, "S70", report.Routes[1].Key)
+	r.Equal(t, []float64{0.5, 1, 1}, report.Routes[1].Punctual)
+	r.Len(t, report.Categories, 2)
+	r.Equal(t, "Stop 0", report.Stations[0].Name)
+	r.Equal(t, 2, report.Stations[0].Count)
+
+	r.Equal(t, []punctuality.Train{{TripID: "1:t2", TripNumber: "t2", Route: "IC", StopName: "Stop 0", MaxDelay: 1200}}, report.WorstTrains)
+	r.Len(t, report.Stats(), 1+2+2+2)
+
+	aggregator.Expire("2025-07-02")
+	r.Empty(t, aggregator.Dates())
+}
+
+func TestReportOrigin(t *testing.T) {
+	aggregator := punctuality.NewAggregator()
+	at := serviceDay + 8*3600 + 60
+
+	// The origin has no real arrival, its departure counts.
+	v := vehicle("t1", "S70", "10", at, 0, 0)
+	v.Trip.Stoptimes[0].RealtimeArrival = 0
+	v.Trip.Stoptimes[0].ArrivalDelay = -28800
+	aggregator.Observe(api.Holavonat{VehiclePositions: []api.VehiclePositions{v}})
+
+	report := aggregator.Report("2025-07-01", 1, time.Unix(at, 0))
+	r.Equal(t, 1, report.Overall.Count)
+	r.Equal(t, 0.0, report.Overall.MeanDelay)
+}
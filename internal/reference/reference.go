@@ -0,0 +1,146 @@
+package reference
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/output"
+)
+
+const ManifestName = "manifest.json"
+
+type File struct {
+	Name  string `json:"name"`
+	Hash  string `json:"hash"`
+	Count int    `json:"count"`
+	Size  int    `json:"size"`
+}
+
+// Manifest points to the current version of every dataset. The dataset files
+// are named after their content hash, only the manifest has to be revalidated.
+// Previous lists the versions they replaced, kept for clients still holding
+// the older manifest.
+type Manifest struct {
+	GeneratedAt string          `json:"generatedAt"`
+	Files       map[string]File `json:"files"`
+	Previous    map[string]File `json:"previous,omitempty"`
+}
+
+type Exporter struct {
+	Publisher *output.Publisher
+	// Path is the directory of the reference files, e.g. "reference".
+	Path string
+	// Keep leaves the replaced versions in place instead of deleting them.
+	Keep bool
+}
+
+// Export writes the datasets and the manifest. The versions the previous
+// manifest pointed to are kept for one more generation, the ones replaced
+// before them are removed.
+func (e *Exporter) Export(ctx context.Context, reference api.Reference, now time.Time) (Manifest, error) {
+	manifestName := path.Join(e.Path, ManifestName)
+
+	var previous Manifest
+	if raw, err := e.Publisher.Load(ctx, manifestName); err == nil {
+		if err := json.Unmarshal(raw, &previous); err != nil {
+			log.New("reference").Warnw("Failed to parse previous manifest", "error", err)
+		}
+	} else if !errors.Is(err, output.ErrNotExist) {
+		log.New("reference").Warnw("Failed to load previous manifest", "error", err)
+	}
+
+	manifest := Manifest{
+		GeneratedAt: now.Format(time.RFC3339),
+		Files:       make(map[string]File),
+		Previous:    make(map[string]File),
+	}
+
+	for dataset, data := range datasets(reference) {
+		raw, err := json.Marshal(data.value)
+		if err != nil {
+			return Manifest{}, err
+		}
+
+		sum := sha256.Sum256(raw)
+		hash := hex.EncodeToString(sum[:8])
+		file := File{
+			Name:  path.Join(e.Path, fmt.Sprintf("%s.%s.json", dataset, hash)),
+			Hash:  hash,
+			Count: data.count,
+			Size:  len(raw),
+		}
+
+		if err := e.Publisher.Publish(ctx, output.Object{
+			Name:         file.Name,
+			ContentType:  "application/json",
+			CacheControl: output.Immutable,
+		}, raw); err != nil {
+			return Manifest{}, err
+		}
+		manifest.Files[dataset] = file
+
+		if old, ok := previous.Files[dataset]; ok && old.Name != file.Name {
+			manifest.Previous[dataset] = old
+		} else if old, ok := previous.Previous[dataset]; ok && old.Name != file.Name {
+			manifest.Previous[dataset] = old
+		}
+	}
+
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := e.Publisher.Publish(ctx, output.Object{
+		Name:         manifestName,
+		ContentType:  "application/json",
+		CacheControl: "no-cache",
+	}, raw); err != nil {
+		return Manifest{}, err
+	}
+
+	if e.Keep {
+		return manifest, nil
+	}
+
+	var errs []error
+	for dataset, file := range previous.Previous {
+		if file.Name != manifest.Files[dataset].Name && file.Name != manifest.Previous[dataset].Name {
+			errs = append(errs, e.Publisher.Delete(ctx, file.Name))
+		}
+	}
+	return manifest, errors.Join(errs...)
+}
+
+type dataset struct {
+	value any
+	count int
+}
+
+// datasets sorts the datasets by ID, so an unchanged network hashes the same.
+func datasets(r api.Reference) map[string]dataset {
+	slices.SortFunc(r.Stops, func(a, b api.ReferenceStop) int { return cmp.Compare(a.GtfsID, b.GtfsID) })
+	slices.SortFunc(r.Stations, func(a, b api.ReferenceStation) int { return cmp.Compare(a.GtfsID, b.GtfsID) })
+	slices.SortFunc(r.Routes, func(a, b api.ReferenceRoute) int { return cmp.Compare(a.GtfsID, b.GtfsID) })
+	slices.SortFunc(r.Patterns, func(a, b api.ReferencePattern) int { return cmp.Compare(a.Code, b.Code) })
+	slices.SortFunc(r.Agencies, func(a, b api.ReferenceAgency) int { return cmp.Compare(a.GtfsID, b.GtfsID) })
+	slices.SortFunc(r.Feeds, func(a, b api.ReferenceFeed) int { return cmp.Compare(a.FeedID, b.FeedID) })
+
+	return map[string]dataset{
+		api.ReferenceStops:    {r.Stops, len(r.Stops)},
+		api.ReferenceStations: {r.Stations, len(r.Stations)},
+		api.ReferenceRoutes:   {r.Routes, len(r.Routes)},
+		api.ReferencePatterns: {r.Patterns, len(r.Patterns)},
+		api.ReferenceAgencies: {r.Agencies, len(r.Agencies)},
+		api.ReferenceFeeds:    {r.Feeds, len(r.Feeds)},
+	}
+}
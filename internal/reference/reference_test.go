@@ -0,0 +1,74 @@
+package reference_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/reference"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+
+	exporter := reference.Exporter{
+		Publisher: &output.Publisher{Destinations: []output.Destination{{Name: "file", Sink: fs, Compression: output.EncodingGzip}}},
+		Path:      "reference",
+	}
+
+	data := api.Reference{
+		Stops:  []api.ReferenceStop{{GtfsID: "1:b", Name: "B"}, {GtfsID: "1:a", Name: "A"}},
+		Routes: []api.ReferenceRoute{{GtfsID: "1:r", Color: "0000FF", TextColor: "FFFFFF"}},
+		Patterns: []api.ReferencePattern{
+			{ID: "p1", Code: "1:r:0:01", Geometry: [][2]float64{{47.5, 19.04}, {47.6, 19.1}}},
+		},
+	}
+
+	first, err := exporter.Export(ctx, data, time.Unix(0, 0))
+	r.NoError(t, err)
+	r.Len(t, first.Files, 6)
+	r.Equal(t, 2, first.Files[api.ReferenceStops].Count)
+
+	raw, err := exporter.Publisher.Load(ctx, first.Files[api.ReferenceStops].Name)
+	r.NoError(t, err)
+	var stops []api.ReferenceStop
+	r.NoError(t, json.Unmarshal(raw, &stops))
+	r.Equal(t, "1:a", stops[0].GtfsID)
+
+	// The order of the upstream does not change the version.
+	data.Stops[0], data.Stops[1] = data.Stops[1], data.Stops[0]
+	data.Routes[0].Color = "FF0000"
+	second, err := exporter.Export(ctx, data, time.Unix(86400, 0))
+	r.NoError(t, err)
+	r.Equal(t, first.Files[api.ReferenceStops], second.Files[api.ReferenceStops])
+	r.NotEqual(t, first.Files[api.ReferenceRoutes].Name, second.Files[api.ReferenceRoutes].Name)
+
+	// The replaced version is kept for one generation.
+	r.Equal(t, first.Files[api.ReferenceRoutes], second.Previous[api.ReferenceRoutes])
+	_, err = exporter.Publisher.Load(ctx, first.Files[api.ReferenceRoutes].Name)
+	r.NoError(t, err)
+
+	raw, err = exporter.Publisher.Load(ctx, "reference/manifest.json")
+	r.NoError(t, err)
+	var manifest reference.Manifest
+	r.NoError(t, json.Unmarshal(raw, &manifest))
+	r.Equal(t, second, manifest)
+
+	// The version replaced before the previous one is removed.
+	data.Routes[0].Color = "00FF00"
+	third, err := exporter.Export(ctx, data, time.Unix(2*86400, 0))
+	r.NoError(t, err)
+	r.Equal(t, second.Files[api.ReferenceRoutes], third.Previous[api.ReferenceRoutes])
+	_, err = exporter.Publisher.Load(ctx, first.Files[api.ReferenceRoutes].Name)
+	r.ErrorIs(t, err, output.ErrNotExist)
+	_, err = exporter.Publisher.Load(ctx, second.Files[api.ReferenceRoutes].Name)
+	r.NoError(t, err)
+	_, err = exporter.Publisher.Load(ctx, third.Files[api.ReferenceStops].Name)
+	r.NoError(t, err)
+}
@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/output"
+)
+
+var ErrNotReadable = errors.New("sink does not support reading objects back")
+
+// Archive is an archived {prefix}_{timestamp}.json snapshot.
+type Archive struct {
+	Name      string
+	Timestamp time.Time
+}
+
+// Timestamp parses the timestamp of an archived snapshot, compressed copies
+// of the filesystem sink included. Other objects sharing the prefix do not
+// match.
+func Timestamp(prefix, name string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(name, prefix+"_")
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, _, ok := strings.Cut(rest, ".json")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, stamp)
+	return t, err == nil
+}
+
+// List returns the archived snapshots between from and to, both inclusive,
+// in timestamp order.
+func List(ctx context.Context, sink output.Sink, prefix string, from, to time.Time) ([]Archive, error) {
+	objects, err := sink.List(ctx, prefix+"_")
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []Archive
+	for _, object := range objects {
+		t, ok := Timestamp(prefix, object.Name)
+		if !ok || t.Before(from) || t.After(to) {
+			continue
+		}
+		archives = append(archives, Archive{Name: object.Name, Timestamp: t})
+	}
+	slices.SortFunc(archives, func(a, b Archive) int {
+		return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.Name, b.Name))
+	})
+	return archives, nil
+}
+
+// ParseRange parses the from and to flags as RFC 3339 times or Budapest
+// dates, a date as to includes the whole day. to defaults to now.
+func ParseRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start, err := parseTime(from, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+
+	end := now
+	if to != "" {
+		if end, err = parseTime(to, true); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to %s is before from %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+func parseTime(value string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, api.Location); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Player publishes archived snapshots in timestamp order. With Step set, it
+// waits for a line on Step before each snapshot. Otherwise it keeps the
+// original gaps divided by Speed, or publishes without waiting when Speed
+// is zero.
+type Player struct {
+	Source  output.Sink
+	Speed   float64
+	Step    io.Reader
+	Publish func(ctx context.Context, data api.Holavonat, timestamp string) error
+}
+
+func (p *Player) Load(ctx context.Context, archive Archive) (api.Holavonat, error) {
+	getter, ok := p.Source.(output.Getter)
+	if !ok {
+		return api.Holavonat{}, ErrNotReadable
+	}
+
+	raw, info, err := getter.Get(ctx, archive.Name)
+	if err != nil {
+		return api.Holavonat{}, err
+	}
+	if raw, err = output.Decompress(raw, info.ContentEncoding); err != nil {
+		return api.Holavonat{}, err
+	}
+
+	var data api.Holavonat
+	err = json.Unmarshal(raw, &data)
+	return data, err
+}
+
+// Play returns when every snapshot was published, the step input ended or
+// ctx is done. A snapshot that fails to load or publish is logged and
+// skipped.
+func (p *Player) Play(ctx context.Context, archives []Archive) error {
+	l := log.New("replay")
+
+	var lines chan struct{}
+	if p.Step != nil {
+		lines = make(chan struct{})
+		go func() {
+			defer close(lines)
+			scanner := bufio.NewScanner(p.Step)
+			for scanner.Scan() {
+				select {
+				case lines <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i, archive := range archives {
+		timestamp := archive.Timestamp.Format(time.RFC3339)
+
+		switch {
+		case lines != nil:
+			l.Infow("Press Enter to publish the next snapshot", "timestamp", timestamp, "remaining", len(archives)-i)
+			select {
+			case _, ok := <-lines:
+				if !ok {
+					return nil
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case p.Speed > 0:
+			offset := time.Duration(float64(archive.Timestamp.Sub(archives[0].Timestamp)) / p.Speed)
+			if err := sleep(ctx, time.Until(start.Add(offset))); err != nil {
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, err := p.Load(ctx, archive)
+		if err != nil {
+			l.Errorw("Failed to load snapshot", "name", archive.Name, "error", err)
+			continue
+		}
+		if err := p.Publish(ctx, data, timestamp); err != nil {
+			l.Errorw("Failed to publish snapshot", "timestamp", timestamp, "error", err)
+			continue
+		}
+		l.Infow("Published snapshot", "timestamp", timestamp, "vehicles", len(data.VehiclePositions))
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
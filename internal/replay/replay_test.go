@@ -0,0 +1,95 @@
+package replay_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/replay"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestTimestamp(t *testing.T) {
+	at, ok := replay.Timestamp("holavonat", "holavonat_2025-07-01T08:00:00+02:00.json.gz")
+	r.True(t, ok)
+	r.Equal(t, time.Date(2025, 7, 1, 6, 0, 0, 0, time.UTC).Unix(), at.Unix())
+
+	for _, name := range []string{
+		"holavonat.json",
+		"holavonat_v4_2025-07-01T08:00:00+02:00.json",
+		"holavonat_alerts_2025-07-01T08:00:00+02:00.pb",
+		"other_2025-07-01T08:00:00+02:00.json",
+	} {
+		_, ok := replay.Timestamp("holavonat", name)
+		r.False(t, ok, name)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2025, 7, 2, 12, 0, 0, 0, api.Location)
+
+	from, to, err := replay.ParseRange("2025-07-01", "2025-07-01", now)
+	r.NoError(t, err)
+	r.Equal(t, time.Date(2025, 7, 1, 0, 0, 0, 0, api.Location), from)
+	r.Equal(t, time.Date(2025, 7, 1, 23, 59, 59, 0, api.Location), to)
+
+	_, to, err = replay.ParseRange("2025-07-01T08:00:00+02:00", "", now)
+	r.NoError(t, err)
+	r.Equal(t, now, to)
+
+	_, _, err = replay.ParseRange("2025-07-02", "2025-07-01", now)
+	r.Error(t, err)
+	_, _, err = replay.ParseRange("yesterday", "", now)
+	r.Error(t, err)
+}
+
+func TestPlay(t *testing.T) {
+	ctx := context.Background()
+	fs, err := output.NewFilesystem(filepath.Join(t.TempDir(), "archive"))
+	r.NoError(t, err)
+
+	publisher := output.Publisher{Destinations: []output.Destination{{Name: "file", Sink: fs, Compression: output.EncodingGzip}}}
+	for stamp, updated := range map[string]string{
+		"2025-07-01T08:00:20+02:00": "20",
+		"2025-07-01T08:00:00+02:00": "1",
+		"2025-07-01T09:00:00+02:00": "3600",
+	} {
+		raw := []byte(`{"lastUpdated":` + updated + `,"vehiclePositions":[]}`)
+		r.NoError(t, publisher.Publish(ctx, output.Object{Name: "holavonat_" + stamp + ".json", Archive: true}, raw))
+	}
+	r.NoError(t, publisher.Publish(ctx, output.Object{Name: "holavonat.json"}, []byte(`{}`)))
+
+	from, to, err := replay.ParseRange("2025-07-01T08:00:00+02:00", "2025-07-01T08:30:00+02:00", time.Now())
+	r.NoError(t, err)
+	archives, err := replay.List(ctx, fs, "holavonat", from, to)
+	r.NoError(t, err)
+	r.Len(t, archives, 2)
+	r.Equal(t, "holavonat_2025-07-01T08:00:00+02:00.json.gz", archives[0].Name)
+
+	var published []string
+	var updated []int64
+	player := replay.Player{
+		Source: fs,
+		Speed:  1000,
+		Publish: func(ctx context.Context, data api.Holavonat, timestamp string) error {
+			published = append(published, timestamp)
+			updated = append(updated, data.LastUpdated)
+			return nil
+		},
+	}
+	start := time.Now()
+	r.NoError(t, player.Play(ctx, archives))
+	r.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	r.Equal(t, []string{"2025-07-01T08:00:00+02:00", "2025-07-01T08:00:20+02:00"}, published)
+	r.Equal(t, []int64{1, 20}, updated)
+
+	// The step input ends after one line.
+	published = nil
+	player.Step = strings.NewReader("\n")
+	r.NoError(t, player.Play(ctx, archives))
+	r.Len(t, published, 1)
+}
@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+type position struct {
+	lat, lon float64
+}
+
+// Adaptive tunes the polling interval to the upstream. While vehicles move it
+// halves the interval down to Min, while the feed is static it grows by half
+// up to Max. Errors back off sharply: a 429 quadruples the interval (or waits
+// for its Retry-After), other errors double it, both up to ErrorMax.
+type Adaptive struct {
+	Min      time.Duration
+	Max      time.Duration
+	ErrorMax time.Duration
+	// MinChanges is the number of moved vehicles that counts as movement.
+	MinChanges int
+
+	interval    time.Duration
+	lastUpdated int
+	positions   map[string]position
+}
+
+func NewAdaptive(minInterval, maxInterval, errorMax time.Duration, minChanges int) *Adaptive {
+	return &Adaptive{
+		Min:        minInterval,
+		Max:        maxInterval,
+		ErrorMax:   max(errorMax, maxInterval),
+		MinChanges: max(minChanges, 1),
+		interval:   minInterval,
+	}
+}
+
+// Observe records the outcome of a cycle and returns the next interval. A nil
+// snapshot means the fetch failed with err.
+func (a *Adaptive) Observe(snapshot *api.Holavonat, err error) time.Duration {
+	if snapshot == nil {
+		factor := time.Duration(2)
+		var statusErr *api.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+			factor = 4
+		}
+		a.interval = min(a.interval*factor, a.ErrorMax)
+		if statusErr != nil && statusErr.RetryAfter > a.interval {
+			a.interval = statusErr.RetryAfter
+		}
+		return a.interval
+	}
+
+	lastUpdated, changed := a.compare(snapshot.VehiclePositions)
+	if lastUpdated > a.lastUpdated && changed >= a.MinChanges {
+		a.interval /= 2
+	} else {
+		a.interval += a.interval / 2
+	}
+	a.interval = min(max(a.interval, a.Min), a.Max)
+	a.lastUpdated = max(a.lastUpdated, lastUpdated)
+
+	return a.interval
+}
+
+// compare returns the newest LastUpdated and the number of vehicles that are
+// new or moved since the previous snapshot.
+func (a *Adaptive) compare(vehicles []api.VehiclePositions) (lastUpdated, changed int) {
+	positions := make(map[string]position, len(vehicles))
+	for _, vehicle := range vehicles {
+		lastUpdated = max(lastUpdated, vehicle.LastUpdated)
+
+		current := position{vehicle.Lat, vehicle.Lon}
+		positions[vehicle.VehicleID] = current
+		if previous, ok := a.positions[vehicle.VehicleID]; !ok || previous != current {
+			changed++
+		}
+	}
+	a.positions = positions
+	return lastUpdated, changed
+}
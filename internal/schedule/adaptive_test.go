@@ -0,0 +1,55 @@
+package schedule_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/schedule"
+	r "github.com/stretchr/testify/require"
+)
+
+func snapshot(lastUpdated int, lat float64) *api.Holavonat {
+	return &api.Holavonat{
+		VehiclePositions: []api.VehiclePositions{
+			{VehicleID: "1", Lat: lat, Lon: 19, LastUpdated: lastUpdated},
+			{VehicleID: "2", Lat: 47, Lon: 19, LastUpdated: lastUpdated - 10},
+		},
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	a := schedule.NewAdaptive(10*time.Second, 60*time.Second, 10*time.Minute, 1)
+
+	r.Equal(t, 10*time.Second, a.Observe(snapshot(100, 47.1), nil))
+
+	// Static feed backs off towards Max.
+	r.Equal(t, 15*time.Second, a.Observe(snapshot(100, 47.1), nil))
+	r.Equal(t, 22500*time.Millisecond, a.Observe(snapshot(100, 47.1), nil))
+	for range 10 {
+		a.Observe(snapshot(100, 47.1), nil)
+	}
+	r.Equal(t, 60*time.Second, a.Observe(snapshot(100, 47.1), nil))
+
+	// A newer LastUpdated without movement is still static.
+	r.Equal(t, 60*time.Second, a.Observe(snapshot(110, 47.1), nil))
+
+	// Moving trains tighten towards Min.
+	r.Equal(t, 30*time.Second, a.Observe(snapshot(120, 47.2), nil))
+	r.Equal(t, 15*time.Second, a.Observe(snapshot(130, 47.3), nil))
+	r.Equal(t, 10*time.Second, a.Observe(snapshot(140, 47.4), nil))
+}
+
+func TestAdaptiveErrors(t *testing.T) {
+	a := schedule.NewAdaptive(10*time.Second, 60*time.Second, 5*time.Minute, 1)
+
+	r.Equal(t, 20*time.Second, a.Observe(nil, errors.New("connection refused")))
+	r.Equal(t, 80*time.Second, a.Observe(nil, &api.StatusError{StatusCode: http.StatusTooManyRequests}))
+	r.Equal(t, 5*time.Minute, a.Observe(nil, &api.StatusError{StatusCode: http.StatusTooManyRequests}))
+	r.Equal(t, 10*time.Minute, a.Observe(nil, &api.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute}))
+
+	// The first success falls back into the normal range.
+	r.Equal(t, 60*time.Second, a.Observe(snapshot(100, 47.1), nil))
+}
@@ -0,0 +1,183 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrEmptySchedule   = errors.New("schedule needs at least one cron expression or time-of-day rule")
+	ErrInvalidClock    = errors.New("invalid time of day, should be HH:MM or HH:MM:SS")
+	ErrInvalidInterval = errors.New("rule interval should be at least one second")
+)
+
+// parser accepts the standard five fields with an optional leading seconds
+// field, the @hourly style descriptors and a CRON_TZ= prefix.
+var parser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Clock is a wall-clock time of day in seconds after midnight.
+type Clock int
+
+func ParseClock(value string) (Clock, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Clock(t.Hour()*3600 + t.Minute()*60 + t.Second()), nil
+		}
+	}
+	if value == "24:00" {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidClock, value)
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d", c/3600, c/60%60, c%60)
+}
+
+// Rule runs every Interval between From (inclusive) and To (exclusive). A
+// window with To before From spans midnight, From equal to To is all day.
+type Rule struct {
+	From     Clock
+	To       Clock
+	Interval time.Duration
+}
+
+func ParseRule(from, to string, interval time.Duration) (Rule, error) {
+	var rule Rule
+	var err error
+	if rule.From, err = ParseClock(from); err != nil {
+		return Rule{}, err
+	}
+	if rule.To, err = ParseClock(to); err != nil {
+		return Rule{}, err
+	}
+	if interval < time.Second {
+		return Rule{}, fmt.Errorf("%w: %s-%s", ErrInvalidInterval, from, to)
+	}
+	rule.Interval = interval
+	return rule, nil
+}
+
+func (r Rule) covers(c Clock) bool {
+	switch {
+	case r.From == r.To:
+		return true
+	case r.From < r.To:
+		return r.From <= c && c < r.To
+	default:
+		return c >= r.From || c < r.To
+	}
+}
+
+// Schedule combines cron expressions and time-of-day rules, the next run is
+// the earliest of them. Wall-clock times are evaluated in Location, so the
+// rules follow the DST changes.
+type Schedule struct {
+	Location *time.Location
+	Crons    []cron.Schedule
+	Rules    []Rule
+}
+
+func New(location *time.Location, expressions []string, rules []Rule) (*Schedule, error) {
+	if len(expressions) == 0 && len(rules) == 0 {
+		return nil, ErrEmptySchedule
+	}
+
+	s := &Schedule{
+		Location: location,
+		Rules:    rules,
+	}
+
+	for _, expression := range expressions {
+		parsed, err := parser.Parse(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+		}
+		// Without CRON_TZ the parser falls back to the local time zone.
+		if spec, ok := parsed.(*cron.SpecSchedule); ok && spec.Location == time.Local {
+			spec.Location = location
+		}
+		s.Crons = append(s.Crons, parsed)
+	}
+
+	return s, nil
+}
+
+// Next returns the first run after now.
+func (s *Schedule) Next(now time.Time) time.Time {
+	var next time.Time
+	for _, c := range s.Crons {
+		if t := c.Next(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if t := s.nextRule(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+		next = t
+	}
+	return next
+}
+
+// nextRule applies the first rule covering now, but never waits past the
+// start of a window, so a tighter window starts on time.
+func (s *Schedule) nextRule(now time.Time) time.Time {
+	if len(s.Rules) == 0 {
+		return time.Time{}
+	}
+
+	local := now.In(s.Location)
+	clock := Clock(local.Hour()*3600 + local.Minute()*60 + local.Second())
+
+	var next time.Time
+	for _, rule := range s.Rules {
+		if rule.covers(clock) {
+			next = now.Add(rule.Interval)
+			break
+		}
+	}
+
+	for _, rule := range s.Rules {
+		if rule.From == rule.To {
+			continue
+		}
+		if t := s.after(local, rule.From); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// after returns the first occurrence of the wall-clock time c after t.
+func (s *Schedule) after(t time.Time, c Clock) time.Time {
+	h, m, sec := int(c/3600), int(c/60%60), int(c%60)
+	for day := 0; ; day++ {
+		next := time.Date(t.Year(), t.Month(), t.Day()+day, h, m, sec, 0, s.Location)
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// Gaps returns the shortest and longest wait between the runs in the span
+// after from.
+func (s *Schedule) Gaps(from time.Time, span time.Duration) (min, max time.Duration) {
+	end := from.Add(span)
+	for t := s.Next(from); !t.IsZero() && t.Before(end); {
+		next := s.Next(t)
+		if next.IsZero() {
+			break
+		}
+		gap := next.Sub(t)
+		if min == 0 || gap < min {
+			min = gap
+		}
+		if gap > max {
+			max = gap
+		}
+		t = next
+	}
+	return min, max
+}
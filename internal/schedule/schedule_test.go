@@ -0,0 +1,87 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/schedule"
+	r "github.com/stretchr/testify/require"
+)
+
+func at(value string) time.Time {
+	t, err := time.ParseInLocation(time.DateTime, value, api.Location)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func rule(t *testing.T, from, to string, interval time.Duration) schedule.Rule {
+	rule, err := schedule.ParseRule(from, to, interval)
+	r.NoError(t, err)
+	return rule
+}
+
+func TestRules(t *testing.T) {
+	s, err := schedule.New(api.Location, nil, []schedule.Rule{
+		rule(t, "06:00", "09:00", 20*time.Second),
+		rule(t, "00:30", "04:00", 5*time.Minute),
+		rule(t, "00:00", "00:00", time.Minute),
+	})
+	r.NoError(t, err)
+
+	r.Equal(t, at("2025-07-01 07:00:20"), s.Next(at("2025-07-01 07:00:00")))
+	r.Equal(t, at("2025-07-01 02:05:00"), s.Next(at("2025-07-01 02:00:00")))
+	r.Equal(t, at("2025-07-01 12:01:00"), s.Next(at("2025-07-01 12:00:00")))
+
+	// The overnight interval does not run into the morning window.
+	r.Equal(t, at("2025-07-01 06:00:00"), s.Next(at("2025-07-01 05:59:30")))
+	r.Equal(t, at("2025-07-01 00:30:00"), s.Next(at("2025-07-01 00:29:30")))
+
+	min, max := s.Gaps(at("2025-07-01 00:00:00"), 24*time.Hour)
+	r.Equal(t, 20*time.Second, min)
+	r.Equal(t, 5*time.Minute, max)
+}
+
+func TestRulesDST(t *testing.T) {
+	s, err := schedule.New(api.Location, nil, []schedule.Rule{
+		rule(t, "22:00", "06:00", 30*time.Minute),
+		rule(t, "06:00", "22:00", time.Minute),
+	})
+	r.NoError(t, err)
+
+	// 2025-03-30 02:00 CET jumps to 03:00 CEST, the night is one hour shorter.
+	r.Equal(t, at("2025-03-30 03:15:00"), s.Next(at("2025-03-30 01:45:00")))
+	r.Equal(t, at("2025-03-30 06:00:00"), s.Next(at("2025-03-30 05:45:00")))
+	_, max := s.Gaps(at("2025-03-29 21:00:00"), 12*time.Hour)
+	r.Equal(t, 30*time.Minute, max)
+
+	// 2025-10-26 03:00 CEST falls back to 02:00 CET, the window still ends at 06:00 CET.
+	fallback := time.Date(2025, 10, 26, 5, 45, 0, 0, api.Location)
+	r.Equal(t, time.Date(2025, 10, 26, 6, 0, 0, 0, api.Location), s.Next(fallback))
+	_, offset := s.Next(fallback).Zone()
+	r.Equal(t, 3600, offset)
+}
+
+func TestCron(t *testing.T) {
+	s, err := schedule.New(api.Location, []string{"0 6 * * *", "*/30 * 7 * * *"}, nil)
+	r.NoError(t, err)
+
+	// Evaluated in Budapest whatever the local time zone is.
+	r.Equal(t, at("2025-07-02 06:00:00"), s.Next(at("2025-07-01 08:00:00")))
+	r.Equal(t, at("2025-07-01 07:00:30"), s.Next(at("2025-07-01 07:00:00")))
+	r.WithinDuration(t, at("2025-07-01 06:00:00"), s.Next(at("2025-07-01 05:00:00").UTC()), 0)
+
+	_, err = schedule.New(api.Location, []string{"* * *"}, nil)
+	r.Error(t, err)
+
+	_, err = schedule.New(api.Location, nil, nil)
+	r.ErrorIs(t, err, schedule.ErrEmptySchedule)
+
+	_, err = schedule.ParseRule("25:00", "06:00", time.Minute)
+	r.ErrorIs(t, err, schedule.ErrInvalidClock)
+
+	_, err = schedule.ParseRule("22:00", "06:00", 30)
+	r.ErrorIs(t, err, schedule.ErrInvalidInterval)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type headerRule struct {
+	pattern *regexp.Regexp
+	set     [][2]string
+	detach  []string
+}
+
+// Headers holds the rules of a Cloudflare Pages style _headers file.
+type Headers []headerRule
+
+// ParseHeaders reads a _headers file: an URL pattern on its own line followed
+// by indented "Name: value" lines. "! Name" removes a header set by an earlier rule.
+func ParseHeaders(reader io.Reader) (Headers, error) {
+	var rules Headers
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			rules = append(rules, headerRule{pattern: compilePattern(trimmed)})
+			continue
+		}
+
+		if len(rules) == 0 {
+			continue
+		}
+		rule := &rules[len(rules)-1]
+
+		if strings.HasPrefix(trimmed, "!") {
+			rule.detach = append(rule.detach, strings.TrimSpace(trimmed[1:]))
+			continue
+		}
+
+		parts := strings.SplitN(trimmed, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		rule.set = append(rule.set, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func compilePattern(pattern string) *regexp.Regexp {
+	// Only the path is matched, absolute URL patterns are reduced to their path.
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if j := strings.Index(pattern[i+3:], "/"); j >= 0 {
+			pattern = pattern[i+3+j:]
+		}
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*':
+			expr.WriteString(".*")
+		case c == ':':
+			j := i + 1
+			for j < len(pattern) && (pattern[j] == '_' || pattern[j] >= 'a' && pattern[j] <= 'z' || pattern[j] >= 'A' && pattern[j] <= 'Z') {
+				j++
+			}
+			if j == i+1 {
+				expr.WriteString(":")
+				continue
+			}
+			expr.WriteString("[^/]+")
+			i = j - 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String())
+}
+
+func (h Headers) Apply(header http.Header, path string) {
+	for _, rule := range h {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		for _, kv := range rule.set {
+			header.Add(kv[0], kv[1])
+		}
+		for _, name := range rule.detach {
+			header.Del(name)
+		}
+	}
+}
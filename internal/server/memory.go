@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/output"
+)
+
+var variants = []string{output.EncodingBrotli, output.EncodingZstd, output.EncodingGzip}
+
+type entry struct {
+	info     output.ObjectInfo
+	variants map[string][]byte
+}
+
+// Memory is a sink keeping the latest objects in memory together with their
+// pre-compressed variants. Archive objects are not stored.
+type Memory struct {
+	objects map[string]*entry
+	mu      sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		objects: make(map[string]*entry),
+	}
+}
+
+func (m *Memory) Put(ctx context.Context, object output.Object, data []byte) (output.ObjectInfo, error) {
+	sum := sha256.Sum256(data)
+	info := output.ObjectInfo{
+		Name:            object.Name,
+		Size:            int64(len(data)),
+		ETag:            hex.EncodeToString(sum[:8]),
+		ContentType:     object.ContentType,
+		ContentEncoding: object.ContentEncoding,
+		CacheControl:    object.CacheControl,
+		Metadata:        object.Metadata,
+		LastModified:    time.Now(),
+	}
+
+	if object.Archive {
+		return info, nil
+	}
+
+	e := &entry{
+		info: info,
+		variants: map[string][]byte{
+			object.ContentEncoding: data,
+		},
+	}
+
+	if object.ContentEncoding == "" {
+		for _, encoding := range variants {
+			if err := ctx.Err(); err != nil {
+				return output.ObjectInfo{}, err
+			}
+			payload, _, err := output.CompressDefault(data, encoding)
+			if err != nil {
+				return output.ObjectInfo{}, err
+			}
+			e.variants[encoding] = payload
+		}
+	}
+
+	m.mu.Lock()
+	m.objects[object.Name] = e
+	m.mu.Unlock()
+
+	return info, nil
+}
+
+func (m *Memory) get(name string) (*entry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.objects[name]
+	return e, ok
+}
+
+func (m *Memory) Get(ctx context.Context, name string) ([]byte, output.ObjectInfo, error) {
+	e, ok := m.get(name)
+	if !ok {
+		return nil, output.ObjectInfo{}, output.ErrNotExist
+	}
+	return e.variants[e.info.ContentEncoding], e.info, nil
+}
+
+func (m *Memory) Stat(ctx context.Context, name string) (output.ObjectInfo, error) {
+	e, ok := m.get(name)
+	if !ok {
+		return output.ObjectInfo{}, output.ErrNotExist
+	}
+	return e.info, nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]output.ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var objects []output.ObjectInfo
+	for name, e := range m.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, e.info)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+
+	return objects, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.objects[name]; !ok {
+		return output.ErrNotExist
+	}
+	delete(m.objects, name)
+	return nil
+}
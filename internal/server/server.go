@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/holavonat/holavonatis/internal/logger"
+	"github.com/holavonat/holavonatis/internal/output"
+)
+
+const (
+	// bundledDataURL is the data origin hard-coded in the bundled static maps.
+	bundledDataURL  = "https://cdn.holavonat.is/"
+	shutdownTimeout = 5 * time.Second
+)
+
+// archivePattern matches the archived JSON snapshots, {prefix}{timestamp}.json
+// with an optional compression suffix. The latest objects and the archives
+// of the other formats share the prefix but do not match.
+const archivePattern = `^%s\d{4}-\d{2}-\d{2}T[^_/]*\.json(\.br|\.gz|\.zst)?$`
+
+type Server struct {
+	Memory        *Memory
+	Static        fs.FS
+	Archive       output.Sink
+	ArchivePrefix string
+	DataURL       string
+	Headers       Headers
+	Mux           *http.ServeMux
+
+	archived *regexp.Regexp
+}
+
+func New(server Server) (*Server, error) {
+	if server.Memory == nil {
+		return nil, errors.New("missing memory sink")
+	}
+
+	if server.Static != nil && server.Headers == nil {
+		file, err := server.Static.Open("_headers")
+		if err == nil {
+			server.Headers, err = ParseHeaders(file)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	server.archived = regexp.MustCompile(fmt.Sprintf(archivePattern, regexp.QuoteMeta(server.ArchivePrefix)))
+
+	server.Mux = http.NewServeMux()
+	server.Mux.HandleFunc("GET /archive/{$}", server.listArchive)
+	server.Mux.HandleFunc("GET /archive/{name...}", server.getArchive)
+	server.Mux.HandleFunc("GET /", server.serve)
+
+	return &server, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Headers.Apply(w.Header(), r.URL.Path)
+	s.Mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves until ctx is done, then shuts the server down. The
+// request contexts (and so the open streams) are derived from ctx.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	if e, ok := s.Memory.get(name); ok {
+		serveEntry(w, r, e)
+		return
+	}
+
+	s.serveStatic(w, r, name)
+}
+
+func serveEntry(w http.ResponseWriter, r *http.Request, e *entry) {
+	encoding := negotiate(r.Header.Get("Accept-Encoding"), e.variants)
+	payload := e.variants[encoding]
+
+	etag := e.info.ETag
+	if encoding != "" {
+		etag += "-" + encoding
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	header.Set("ETag", strconv.Quote(etag))
+	header.Set("Cache-Control", "no-cache")
+	if e.info.CacheControl != "" {
+		header.Set("Cache-Control", e.info.CacheControl)
+	}
+	if e.info.ContentType != "" {
+		header.Set("Content-Type", e.info.ContentType)
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+
+	http.ServeContent(w, r, e.info.Name, e.info.LastModified, bytes.NewReader(payload))
+}
+
+// negotiate picks the preferred encoding accepted by the client, "" is identity.
+func negotiate(accept string, available map[string][]byte) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[coding] = q > 0
+	}
+
+	for _, encoding := range variants {
+		ok, listed := accepted[encoding]
+		if !listed {
+			ok = accepted["*"]
+		}
+		if _, has := available[encoding]; ok && has {
+			return encoding
+		}
+	}
+
+	if _, has := available[""]; has {
+		return ""
+	}
+
+	// Only a compressed variant was stored, serve it as is.
+	for encoding := range available {
+		return encoding
+	}
+	return ""
+}
+
+func (s *Server) serveStatic(w http.ResponseWriter, r *http.Request, name string) {
+	if s.Static == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+
+	// Files starting with an underscore (_headers) are configuration, not content.
+	if strings.HasPrefix(path.Base(name), "_") {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := fs.ReadFile(s.Static, name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.DataURL != "" && strings.HasSuffix(name, ".html") {
+		data = bytes.ReplaceAll(data, []byte(bundledDataURL), []byte(s.DataURL))
+	}
+
+	var modtime time.Time
+	if stat, err := fs.Stat(s.Static, name); err == nil {
+		modtime = stat.ModTime()
+	}
+
+	http.ServeContent(w, r, name, modtime, bytes.NewReader(data))
+}
+
+func (s *Server) listArchive(w http.ResponseWriter, r *http.Request) {
+	if s.Archive == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	objects, err := s.Archive.List(r.Context(), s.ArchivePrefix)
+	if err != nil {
+		log.New("server").Errorw("Failed to list archive", "error", err)
+		http.Error(w, "failed to list archive", http.StatusBadGateway)
+		return
+	}
+
+	objects = slices.DeleteFunc(objects, func(info output.ObjectInfo) bool {
+		return !s.archived.MatchString(info.Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(objects)
+}
+
+func (s *Server) getArchive(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if s.Archive == nil || !strings.HasPrefix(name, s.ArchivePrefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	getter, ok := s.Archive.(output.Getter)
+	if !ok {
+		info, err := s.Archive.Stat(r.Context(), name)
+		if err != nil || info.PublicLink == "" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, info.PublicLink, http.StatusFound)
+		return
+	}
+
+	data, info, err := getter.Get(r.Context(), name)
+	if errors.Is(err, output.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.New("server").Errorw("Failed to get archive", "name", name, "error", err)
+		http.Error(w, "failed to get archive", http.StatusBadGateway)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", output.Immutable)
+	if info.ContentType != "" {
+		header.Set("Content-Type", info.ContentType)
+	}
+	if info.ContentEncoding != "" {
+		header.Set("Content-Encoding", info.ContentEncoding)
+	}
+	if info.ETag != "" {
+		header.Set("ETag", strconv.Quote(strings.Trim(info.ETag, `"`)))
+	}
+
+	http.ServeContent(w, r, path.Base(name), info.LastModified, bytes.NewReader(data))
+}
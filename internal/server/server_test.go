@@ -0,0 +1,114 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/holavonat/holavonatis/internal/output"
+	"github.com/holavonat/holavonatis/internal/server"
+	r "github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	memory := server.NewMemory()
+	_, err := memory.Put(context.Background(), output.Object{Name: "data.json", ContentType: "application/json"}, []byte(`{"vehiclePositions":[]}`))
+	r.NoError(t, err)
+	_, err = memory.Put(context.Background(), output.Object{Name: "data_1.json", Archive: true}, []byte(`{}`))
+	r.NoError(t, err)
+
+	srv, err := server.New(server.Server{
+		Memory: memory,
+		Static: fstest.MapFS{
+			"index.html": {Data: []byte(`fetch("https://cdn.holavonat.is/data.json")`)},
+			"_headers":   {Data: []byte("/*\n  X-Frame-Options: SAMEORIGIN\n/data.json\n  ! X-Frame-Options\n")},
+		},
+		DataURL: "/",
+	})
+	r.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/data.json", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br;q=0.9")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusOK, rec.Code)
+	r.Equal(t, "br", rec.Header().Get("Content-Encoding"))
+	r.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	r.Empty(t, rec.Header().Get("X-Frame-Options"))
+	etag := rec.Header().Get("ETag")
+	r.NotEmpty(t, etag)
+
+	req = httptest.NewRequest(http.MethodGet, "/data.json", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusNotModified, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/data.json", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Empty(t, rec.Header().Get("Content-Encoding"))
+	r.JSONEq(t, `{"vehiclePositions":[]}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/data_1.json", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusOK, rec.Code)
+	r.Equal(t, "SAMEORIGIN", rec.Header().Get("X-Frame-Options"))
+	r.True(t, strings.Contains(rec.Body.String(), `fetch("/data.json")`))
+
+	req = httptest.NewRequest(http.MethodGet, "/_headers", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServerArchive(t *testing.T) {
+	archive, err := output.NewFilesystem(t.TempDir())
+	r.NoError(t, err)
+	for _, name := range []string{
+		"data.json",
+		"data_vehicle_positions.pb",
+		"data_2025-07-01T12:00:00+02:00.json",
+		"data_v4_2025-07-01T12:00:00+02:00.json",
+		"data_delta_2025-07-01T12:00:00+02:00.json",
+		"data_2025-07-01T12:00:00+02:00.geojson",
+		"data_vehicle_positions_2025-07-01T12:00:00+02:00.pb",
+	} {
+		_, err = archive.Put(context.Background(), output.Object{Name: name}, []byte(`{}`))
+		r.NoError(t, err)
+	}
+
+	srv, err := server.New(server.Server{
+		Memory:        server.NewMemory(),
+		Archive:       archive,
+		ArchivePrefix: "data_",
+	})
+	r.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/archive/", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusOK, rec.Code)
+
+	var objects []output.ObjectInfo
+	r.NoError(t, json.Unmarshal(rec.Body.Bytes(), &objects))
+	r.Len(t, objects, 1)
+	r.Equal(t, "data_2025-07-01T12:00:00+02:00.json", objects[0].Name)
+
+	req = httptest.NewRequest(http.MethodGet, "/archive/"+objects[0].Name, nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	r.Equal(t, http.StatusOK, rec.Code)
+	r.JSONEq(t, `{}`, rec.Body.String())
+}
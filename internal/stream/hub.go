@@ -0,0 +1,145 @@
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	log "github.com/holavonat/holavonatis/internal/logger"
+)
+
+const defaultBuffer = 16
+
+type Event struct {
+	Type string
+	Data []byte
+}
+
+type Subscriber struct {
+	C      chan Event
+	Filter Filter
+}
+
+// Hub fans the snapshots of the fetch loop out to the live subscribers. The
+// first event of a subscriber is a full snapshot, the rest are diffs. Slow
+// subscribers whose buffer is full are dropped.
+type Hub struct {
+	current     *snapshot
+	subscribers map[*Subscriber]struct{}
+	Buffer      int
+	mu          sync.Mutex
+}
+
+func NewHub(buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	return &Hub{
+		subscribers: make(map[*Subscriber]struct{}),
+		Buffer:      buffer,
+	}
+}
+
+func encode(message Message) (Event, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: message.Type, Data: data}, nil
+}
+
+func (h *Hub) Subscribe(filter Filter) *Subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &Subscriber{
+		C:      make(chan Event, h.Buffer),
+		Filter: filter,
+	}
+
+	if h.current != nil {
+		event, err := encode(h.current.full(filter))
+		if err != nil {
+			log.New("stream").Errorw("Failed to encode snapshot", "error", err)
+		} else {
+			s.C <- event
+		}
+	}
+
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+func (h *Hub) remove(s *Subscriber) {
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.C)
+	}
+}
+
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+func (h *Hub) Publish(data api.Holavonat) {
+	l := log.New("stream")
+	next := newSnapshot(data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev := h.current
+	h.current = next
+
+	// Subscribers with the same filter share the encoded event.
+	events := make(map[string]*Event)
+	dropped := 0
+	for s := range h.subscribers {
+		key := s.Filter.Key()
+		event, ok := events[key]
+		if !ok {
+			var message Message
+			if prev == nil {
+				message = next.full(s.Filter)
+			} else {
+				message = diff(prev, next, s.Filter)
+			}
+
+			if message.Type == TypeDiff && message.Empty() {
+				event = nil
+			} else {
+				encoded, err := encode(message)
+				if err != nil {
+					l.Errorw("Failed to encode stream message", "error", err)
+					continue
+				}
+				event = &encoded
+			}
+			events[key] = event
+		}
+
+		if event == nil {
+			continue
+		}
+
+		select {
+		case s.C <- *event:
+		default:
+			h.remove(s)
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		l.Warnw("Dropped slow stream subscribers", "dropped", dropped)
+	}
+	l.Debugw("Published snapshot to stream", "subscribers", len(h.subscribers), "filters", len(events))
+}
@@ -0,0 +1,100 @@
+package stream_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/holavonat/holavonatis/internal/api"
+	"github.com/holavonat/holavonatis/internal/stream"
+	r "github.com/stretchr/testify/require"
+)
+
+func vehicle(id, mode string, lat, lon float64) api.VehiclePositions {
+	return api.VehiclePositions{
+		VehicleID: id,
+		Lat:       lat,
+		Lon:       lon,
+		Trip:      api.Trip{Route: api.Route{Mode: mode}},
+	}
+}
+
+func next(t *testing.T, s *stream.Subscriber) stream.Message {
+	t.Helper()
+	select {
+	case event := <-s.C:
+		var message stream.Message
+		r.NoError(t, json.Unmarshal(event.Data, &message))
+		r.Equal(t, event.Type, message.Type)
+		return message
+	default:
+		t.Fatal("no event")
+	}
+	return stream.Message{}
+}
+
+func TestHub(t *testing.T) {
+	hub := stream.NewHub(4)
+	hub.Publish(api.Holavonat{VehiclePositions: []api.VehiclePositions{
+		vehicle("a", "RAIL", 47.5, 19.0),
+		vehicle("b", "TRAM", 47.5, 19.1),
+		vehicle("c", "RAIL", 46.0, 18.0),
+	}})
+
+	filter, err := stream.ParseFilter(url.Values{"bbox": {"47,18.5,48,19.5"}, "modes": {"rail"}})
+	r.NoError(t, err)
+
+	all := hub.Subscribe(stream.Filter{})
+	budapest := hub.Subscribe(filter)
+
+	message := next(t, all)
+	r.Equal(t, stream.TypeSnapshot, message.Type)
+	r.Len(t, message.Vehicles, 3)
+
+	message = next(t, budapest)
+	r.Len(t, message.Vehicles, 1)
+	r.Equal(t, "a", message.Vehicles[0].VehicleID)
+
+	hub.Publish(api.Holavonat{VehiclePositions: []api.VehiclePositions{
+		vehicle("a", "RAIL", 46.5, 19.0),
+		vehicle("b", "TRAM", 47.6, 19.1),
+		vehicle("c", "RAIL", 47.2, 19.0),
+		vehicle("d", "RAIL", 47.3, 19.0),
+	}})
+
+	message = next(t, all)
+	r.Equal(t, stream.TypeDiff, message.Type)
+	r.Len(t, message.Added, 1)
+	r.Len(t, message.Moved, 3)
+	r.Empty(t, message.Removed)
+
+	message = next(t, budapest)
+	r.Equal(t, []string{"a"}, message.Removed)
+	r.Len(t, message.Added, 2)
+	r.Empty(t, message.Moved)
+
+	hub.Unsubscribe(all)
+	r.Equal(t, 1, hub.Subscribers())
+}
+
+func TestHubReplayDelays(t *testing.T) {
+	// A recorded snapshot, the first stop is still ahead at its last update.
+	recorded := func(delay int64) api.VehiclePositions {
+		v := vehicle("a", "RAIL", 47.5, 19.0)
+		v.LastUpdated = 1704186000
+		v.Trip.Stoptimes = []api.Stoptimes{
+			{ServiceDay: 1704150000, RealtimeArrival: 36600, ArrivalDelay: delay},
+			{ServiceDay: 1704150000, RealtimeArrival: 40000, ArrivalDelay: 600},
+		}
+		return v
+	}
+
+	hub := stream.NewHub(4)
+	hub.Publish(api.Holavonat{VehiclePositions: []api.VehiclePositions{recorded(60)}})
+	s := hub.Subscribe(stream.Filter{})
+	next(t, s)
+
+	hub.Publish(api.Holavonat{VehiclePositions: []api.VehiclePositions{recorded(120)}})
+	message := next(t, s)
+	r.Equal(t, []stream.DelayChange{{VehicleID: "a", Delay: 120}}, message.Delayed)
+}
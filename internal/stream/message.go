@@ -0,0 +1,208 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holavonat/holavonatis/internal/api"
+)
+
+const (
+	TypeSnapshot = "snapshot"
+	TypeDiff     = "diff"
+)
+
+type Message struct {
+	Type        string                 `json:"type"`
+	Timestamp   string                 `json:"timestamp"`
+	LastUpdated int64                  `json:"lastUpdated"`
+	Vehicles    []api.VehiclePositions `json:"vehicles,omitempty"`
+	Added       []api.VehiclePositions `json:"added,omitempty"`
+	Moved       []Movement             `json:"moved,omitempty"`
+	Delayed     []DelayChange          `json:"delayed,omitempty"`
+	Removed     []string               `json:"removed,omitempty"`
+}
+
+type Movement struct {
+	VehicleID   string  `json:"vehicleId"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Heading     float64 `json:"heading"`
+	Speed       float64 `json:"speed"`
+	LastUpdated int     `json:"lastUpdated"`
+}
+
+type DelayChange struct {
+	VehicleID string `json:"vehicleId"`
+	Delay     int64  `json:"delay"`
+}
+
+func (m *Message) Empty() bool {
+	return len(m.Vehicles) == 0 && len(m.Added) == 0 && len(m.Moved) == 0 && len(m.Delayed) == 0 && len(m.Removed) == 0
+}
+
+// Filter limits the vehicles a subscriber receives. Zero value matches everything.
+type Filter struct {
+	Modes  []string
+	BBox   [4]float64
+	HasBox bool
+}
+
+// ParseFilter reads ?bbox=swLat,swLon,neLat,neLon&modes=RAIL,TRAM.
+func ParseFilter(query url.Values) (Filter, error) {
+	var filter Filter
+
+	if bbox := query.Get("bbox"); bbox != "" {
+		parts := strings.Split(bbox, ",")
+		if len(parts) != 4 {
+			return Filter{}, errors.New("bbox should be swLat,swLon,neLat,neLon")
+		}
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return Filter{}, fmt.Errorf("invalid bbox: %w", err)
+			}
+			filter.BBox[i] = v
+		}
+		filter.HasBox = true
+	}
+
+	if modes := query.Get("modes"); modes != "" {
+		for _, mode := range strings.Split(modes, ",") {
+			if mode = strings.ToUpper(strings.TrimSpace(mode)); mode != "" {
+				filter.Modes = append(filter.Modes, mode)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+func (f Filter) Key() string {
+	return fmt.Sprint(f.HasBox, f.BBox, f.Modes)
+}
+
+func (f Filter) Match(vehicle *api.VehiclePositions) bool {
+	if f.HasBox {
+		if vehicle.Lat < f.BBox[0] || vehicle.Lon < f.BBox[1] || vehicle.Lat > f.BBox[2] || vehicle.Lon > f.BBox[3] {
+			return false
+		}
+	}
+
+	if len(f.Modes) > 0 {
+		for _, mode := range f.Modes {
+			if vehicle.Trip.Route.Mode == mode {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+type snapshot struct {
+	vehicles    map[string]*api.VehiclePositions
+	delays      map[string]int64
+	order       []string
+	timestamp   string
+	lastUpdated int64
+}
+
+// newSnapshot computes the delays at the last update of each vehicle, like the
+// other outputs, so a replayed snapshot has the delays it had when recorded.
+func newSnapshot(data api.Holavonat) *snapshot {
+	s := &snapshot{
+		vehicles:    make(map[string]*api.VehiclePositions, len(data.VehiclePositions)),
+		delays:      make(map[string]int64, len(data.VehiclePositions)),
+		timestamp:   data.Timestamp,
+		lastUpdated: data.LastUpdated,
+	}
+
+	for i := range data.VehiclePositions {
+		vehicle := &data.VehiclePositions[i]
+		if vehicle.VehicleID == "" {
+			continue
+		}
+		if _, ok := s.vehicles[vehicle.VehicleID]; !ok {
+			s.order = append(s.order, vehicle.VehicleID)
+		}
+		s.vehicles[vehicle.VehicleID] = vehicle
+		s.delays[vehicle.VehicleID] = vehicle.Delay(time.Unix(int64(vehicle.LastUpdated), 0))
+	}
+
+	return s
+}
+
+func (s *snapshot) full(filter Filter) Message {
+	message := Message{
+		Type:        TypeSnapshot,
+		Timestamp:   s.timestamp,
+		LastUpdated: s.lastUpdated,
+		Vehicles:    []api.VehiclePositions{},
+	}
+
+	for _, id := range s.order {
+		if vehicle := s.vehicles[id]; filter.Match(vehicle) {
+			message.Vehicles = append(message.Vehicles, *vehicle)
+		}
+	}
+
+	return message
+}
+
+// diff returns the changes between two snapshots as seen through filter: a
+// vehicle leaving the filtered area is removed, one entering it is added.
+func diff(prev, next *snapshot, filter Filter) Message {
+	message := Message{
+		Type:        TypeDiff,
+		Timestamp:   next.timestamp,
+		LastUpdated: next.lastUpdated,
+	}
+
+	for _, id := range next.order {
+		vehicle := next.vehicles[id]
+		if !filter.Match(vehicle) {
+			continue
+		}
+
+		old, ok := prev.vehicles[id]
+		if !ok || !filter.Match(old) {
+			message.Added = append(message.Added, *vehicle)
+			continue
+		}
+
+		if old.Lat != vehicle.Lat || old.Lon != vehicle.Lon || old.Heading != vehicle.Heading || old.Speed != vehicle.Speed {
+			message.Moved = append(message.Moved, Movement{
+				VehicleID:   id,
+				Lat:         vehicle.Lat,
+				Lon:         vehicle.Lon,
+				Heading:     vehicle.Heading,
+				Speed:       vehicle.Speed,
+				LastUpdated: vehicle.LastUpdated,
+			})
+		}
+
+		if prev.delays[id] != next.delays[id] {
+			message.Delayed = append(message.Delayed, DelayChange{
+				VehicleID: id,
+				Delay:     next.delays[id],
+			})
+		}
+	}
+
+	for _, id := range prev.order {
+		if !filter.Match(prev.vehicles[id]) {
+			continue
+		}
+		if vehicle, ok := next.vehicles[id]; !ok || !filter.Match(vehicle) {
+			message.Removed = append(message.Removed, id)
+		}
+	}
+
+	return message
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	r "github.com/stretchr/testify/require"
+)
+
+func TestMainExitCode(t *testing.T) {
+	r.Equal(t, 0, Main([]string{"help"}))
+	r.Equal(t, 2, Main([]string{"bogus"}))
+	r.Equal(t, 0, Main([]string{"convert", "-h"}))
+	r.Equal(t, 1, Main([]string{"convert"}))
+}
+
+func TestMainOnceFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	r.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`
+EulaAccepted: true
+GraphqlEndpoint: `+srv.URL+`
+Cron:
+  Mode: fix
+  Fix:
+    Interval: 1
+Network:
+  Retry:
+    MaxAttempts: 1
+`), 0o644))
+	t.Chdir(dir)
+
+	r.Equal(t, 1, Main([]string{"once"}))
+	r.Equal(t, 2, Main([]string{"once", "extra"}))
+}